@@ -0,0 +1,204 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"sort"
+	"time"
+
+	"github.com/intelsdi-x/snap/control/plugin"
+	"github.com/intelsdi-x/snap/core"
+)
+
+const (
+	// namespace element of aggregates over all filesystems
+	nsTotal = "_total"
+	// namespace element preceding type of filesystems aggregated
+	nsByType = "_by_type"
+)
+
+var aggregateMetricsKind = []string{
+	"space_total",
+	"space_free",
+	"space_reserved",
+	"space_used",
+	"space_percent_used_max",
+	"inodes_total",
+	"inodes_free",
+	"inodes_reserved",
+	"inodes_used",
+	"inodes_percent_used_max",
+	"mounts",
+}
+
+// aggregate holds capacity and usage summed over filesystems
+type aggregate struct {
+	Blocks, Used, Available uint64
+	Inodes, IUsed, IFree    uint64
+	// the highest percentage of used space and inodes
+	SpacePercentMax, InodesPercentMax float64
+	// mounts including bind mounts of the same filesystem
+	Mounts uint64
+}
+
+// add accounts filesystem in aggregate
+func (a *aggregate) add(dfm dfMetric) {
+	a.Blocks += dfm.Blocks
+	a.Used += dfm.Used
+	a.Available += dfm.Available
+	a.Inodes += dfm.Inodes
+	a.IUsed += dfm.IUsed
+	a.IFree += dfm.IFree
+	if p := ceilPercent(dfm.Used, dfm.Blocks); p > a.SpacePercentMax {
+		a.SpacePercentMax = p
+	}
+	if p := ceilPercent(dfm.IUsed, dfm.Inodes); p > a.InodesPercentMax {
+		a.InodesPercentMax = p
+	}
+}
+
+// aggregateFilesystems returns aggregates over all filesystems and by type of
+// filesystem, capacity of filesystem mounted more than once is accounted once
+// while all its mounts (also aliases of deduplicated filesystem) are counted
+func aggregateFilesystems(dfms []dfMetric) (aggregate, map[string]*aggregate) {
+	total := aggregate{}
+	byType := map[string]*aggregate{}
+	for _, dfm := range dfms {
+		if byType[dfm.FsType] == nil {
+			byType[dfm.FsType] = &aggregate{}
+		}
+		mounts := 1 + uint64(len(dfm.Aliases))
+		total.Mounts += mounts
+		byType[dfm.FsType].Mounts += mounts
+	}
+	for _, dfm := range deduplicate(dfms, deduplicateDevice, preferFirst) {
+		total.add(dfm)
+		byType[dfm.FsType].add(dfm)
+	}
+	return total, byType
+}
+
+// Return true if namespace requests aggregates:
+// /intel/procfs/filesystem/_total/<metric> or
+// /intel/procfs/filesystem/_by_type/<fs_type>/<metric>
+func isAggregateNamespace(ns core.Namespace) bool {
+	lns := len(ns)
+	return lns == 5 && ns[len(namespacePrefix)].Value == nsTotal ||
+		lns == 6 && ns[len(namespacePrefix)].Value == nsByType
+}
+
+// aggregateMetricTypes returns metric types of aggregates
+func aggregateMetricTypes() []plugin.MetricType {
+	mts := []plugin.MetricType{}
+	for _, kind := range aggregateMetricsKind {
+		mts = append(mts, plugin.MetricType{
+			Namespace_: core.NewNamespace(namespacePrefix...).
+				AddStaticElements(nsTotal, kind),
+			Description_: "aggregate over all filesystems: " + kind,
+		})
+		mts = append(mts, plugin.MetricType{
+			Namespace_: core.NewNamespace(namespacePrefix...).
+				AddStaticElement(nsByType).
+				AddDynamicElement("fs_type", "type of filesystems").
+				AddStaticElement(kind),
+			Description_: "aggregate over filesystems of given type: " + kind,
+		})
+	}
+	return mts
+}
+
+// Function to fill metric with aggregated value
+func fillAggregateMetric(kind string, a *aggregate, metric *plugin.MetricType) {
+	switch kind {
+	case "space_total":
+		metric.Data_ = a.Blocks
+	case "space_free":
+		metric.Data_ = a.Available
+	case "space_reserved":
+		metric.Data_ = a.Blocks - (a.Used + a.Available)
+	case "space_used":
+		metric.Data_ = a.Used
+	case "space_percent_used_max":
+		metric.Data_ = a.SpacePercentMax
+	case "inodes_total":
+		metric.Data_ = a.Inodes
+	case "inodes_free":
+		metric.Data_ = a.IFree
+	case "inodes_reserved":
+		metric.Data_ = a.Inodes - (a.IUsed + a.IFree)
+	case "inodes_used":
+		metric.Data_ = a.IUsed
+	case "inodes_percent_used_max":
+		metric.Data_ = a.InodesPercentMax
+	case "mounts":
+		metric.Data_ = a.Mounts
+	}
+}
+
+// aggregateMetrics returns aggregates matching namespace
+func aggregateMetrics(ns core.Namespace, dfms []dfMetric, curTime time.Time) []plugin.MetricType {
+	metrics := []plugin.MetricType{}
+	total, byType := aggregateFilesystems(dfms)
+	kind := ns[len(ns)-1].Value
+	if ns[len(namespacePrefix)].Value == nsTotal {
+		for _, k := range aggregateMetricsKind {
+			if !matchElement(kind, k) {
+				continue
+			}
+			metric := plugin.MetricType{
+				Timestamp_: curTime,
+				Namespace_: core.NewNamespace(namespacePrefix...).AddStaticElements(nsTotal, k),
+				Tags_:      map[string]string{},
+			}
+			fillAggregateMetric(k, &total, &metric)
+			metrics = append(metrics, metric)
+		}
+		return metrics
+	}
+	fsTypes := []string{}
+	for fsType := range byType {
+		fsTypes = append(fsTypes, fsType)
+	}
+	sort.Strings(fsTypes)
+	for _, fsType := range fsTypes {
+		if !matchElement(ns[len(ns)-2].Value, fsType) {
+			continue
+		}
+		for _, k := range aggregateMetricsKind {
+			if !matchElement(kind, k) {
+				continue
+			}
+			metric := plugin.MetricType{
+				Timestamp_: curTime,
+				Namespace_: core.NewNamespace(namespacePrefix...).
+					AddStaticElement(nsByType).
+					AddDynamicElement("fs_type", "type of filesystems").
+					AddStaticElement(k),
+				Tags_: map[string]string{"fs_type": fsType},
+			}
+			metric.Namespace_[len(namespacePrefix)+1].Value = fsType
+			fillAggregateMetric(k, byType[fsType], &metric)
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,98 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/intelsdi-x/snap/core"
+)
+
+func TestAggregates(t *testing.T) {
+	Convey("Given filesystems", t, func() {
+		dfms := []dfMetric{
+			{MajorMinor: "8:1", FsType: "ext4", UnchangedMountPoint: "/", Blocks: 100, Used: 50, Available: 40, Inodes: 1000, IUsed: 100, IFree: 900},
+			{MajorMinor: "8:1", FsType: "ext4", UnchangedMountPoint: "/etc/hosts", Blocks: 100, Used: 50, Available: 40, Inodes: 1000, IUsed: 100, IFree: 900},
+			{MajorMinor: "8:2", FsType: "ext4", UnchangedMountPoint: "/data", Blocks: 200, Used: 180, Available: 20, Inodes: 2000, IUsed: 1000, IFree: 1000},
+			{MajorMinor: "0:50", FsType: "nfs", UnchangedMountPoint: "/home", Blocks: 1000, Used: 100, Available: 900, Inodes: 100, IUsed: 90, IFree: 10},
+		}
+		now := time.Now()
+
+		Convey("When aggregates over all filesystems are requested", func() {
+			metrics := aggregateMetrics(core.NewNamespace("intel", "procfs", "filesystem", "_total", "*"), dfms, now)
+			values := map[string]interface{}{}
+			for _, m := range metrics {
+				values[m.Namespace()[4].Value] = m.Data()
+			}
+
+			Convey("Then capacity of filesystem mounted twice is accounted once", func() {
+				So(len(metrics), ShouldEqual, len(aggregateMetricsKind))
+				So(values["space_total"], ShouldEqual, 1300)
+				So(values["space_used"], ShouldEqual, 330)
+				So(values["space_free"], ShouldEqual, 960)
+				So(values["space_reserved"], ShouldEqual, 10)
+				So(values["inodes_used"], ShouldEqual, 1190)
+				So(values["mounts"], ShouldEqual, 4)
+			})
+
+			Convey("Then the highest percentage is reported", func() {
+				So(values["space_percent_used_max"], ShouldEqual, 90.0)
+				So(values["inodes_percent_used_max"], ShouldEqual, 90.0)
+			})
+		})
+
+		Convey("When aggregates by type are requested", func() {
+			metrics := aggregateMetrics(core.NewNamespace("intel", "procfs", "filesystem", "_by_type", "*", "space_used"), dfms, now)
+
+			Convey("Then each type is reported", func() {
+				So(len(metrics), ShouldEqual, 2)
+				So(metrics[0].Namespace().String(), ShouldEqual, "/intel/procfs/filesystem/_by_type/ext4/space_used")
+				So(metrics[0].Namespace()[4].Name, ShouldEqual, "fs_type")
+				So(metrics[0].Tags()["fs_type"], ShouldEqual, "ext4")
+				So(metrics[0].Data(), ShouldEqual, 230)
+				So(metrics[1].Data(), ShouldEqual, 100)
+			})
+
+			metrics = aggregateMetrics(core.NewNamespace("intel", "procfs", "filesystem", "_by_type", "nfs", "mounts"), dfms, now)
+			So(len(metrics), ShouldEqual, 1)
+			So(metrics[0].Data(), ShouldEqual, 1)
+		})
+
+		Convey("When filesystems are deduplicated before aggregation", func() {
+			deduplicated := deduplicate(dfms, deduplicateDevice, preferShortest)
+			metrics := aggregateMetrics(core.NewNamespace("intel", "procfs", "filesystem", "_total", "mounts"), deduplicated, now)
+
+			Convey("Then aliases are counted as mounts", func() {
+				So(len(deduplicated), ShouldEqual, 3)
+				So(metrics[0].Data(), ShouldEqual, 4)
+			})
+		})
+	})
+
+	Convey("Given namespaces", t, func() {
+		So(isAggregateNamespace(core.NewNamespace("intel", "procfs", "filesystem", "_total", "space_used")), ShouldBeTrue)
+		So(isAggregateNamespace(core.NewNamespace("intel", "procfs", "filesystem", "_by_type", "ext4", "space_used")), ShouldBeTrue)
+		So(isAggregateNamespace(core.NewNamespace("intel", "procfs", "filesystem", "rootfs", "space_used")), ShouldBeFalse)
+		So(isAggregateNamespace(core.NewNamespace("intel", "procfs", "filesystem", "_total")), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,220 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// attributor adds tags describing owner of filesystem,
+// it is run for every filesystem after statistics are collected
+type attributor interface {
+	attribute(dfm *dfMetric)
+}
+
+// attributors available for attribution configuration option,
+// constructors get value of attribution_resolve_names option
+var attributors = map[string]func(resolveNames bool) attributor{
+	"containers": newContainerAttributor,
+	"kubernetes": newKubernetesAttributor,
+}
+
+// newAttributors returns attributors for list of names (see parseList)
+func newAttributors(names string, resolveNames bool) ([]attributor, error) {
+	list, err := parseList(Attribution, names)
+	if err != nil {
+		return nil, err
+	}
+	result := []attributor{}
+	for _, name := range list {
+		constructor, ok := attributors[name]
+		if !ok {
+			known := []string{}
+			for k := range attributors {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("%s: unknown attribution %q, expected one of %s",
+				Attribution, name, strings.Join(known, ", "))
+		}
+		result = append(result, constructor(resolveNames))
+	}
+	return result, nil
+}
+
+// Function to run attributors for all filesystems
+func attribute(attributors []attributor, dfms []dfMetric) {
+	for _, a := range attributors {
+		for i := range dfms {
+			a.attribute(&dfms[i])
+		}
+	}
+}
+
+// setAttribute adds attribute to filesystem
+func (dfm *dfMetric) setAttribute(key string, value string) {
+	if dfm.Attributes == nil {
+		dfm.Attributes = map[string]string{}
+	}
+	dfm.Attributes[key] = value
+}
+
+// containerRule extracts owner of mount point from its path,
+// named groups of pattern become attributes of filesystem
+type containerRule struct {
+	runtime string
+	pattern *regexp.Regexp
+	// returns path of file holding container name or empty string,
+	// it gets values of named groups
+	stateFile func(groups map[string]string) string
+	// returns container name from content of state file
+	name func(content []byte) string
+}
+
+// dockerName reads container name from docker config.v2.json
+func dockerName(content []byte) string {
+	var cfg struct {
+		Name string
+	}
+	if json.Unmarshal(content, &cfg) != nil {
+		return ""
+	}
+	return strings.TrimPrefix(cfg.Name, "/")
+}
+
+// ociName reads container name from annotations of OCI config.json
+// written by CRI-O and containerd
+func ociName(content []byte) string {
+	var cfg struct {
+		Annotations map[string]string `json:"annotations"`
+	}
+	if json.Unmarshal(content, &cfg) != nil {
+		return ""
+	}
+	for _, key := range []string{
+		"io.kubernetes.cri-o.ContainerName",
+		"io.kubernetes.cri.container-name",
+		"io.kubernetes.container.name",
+	} {
+		if name := cfg.Annotations[key]; name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// built-in rules of container attribution
+var containerRules = []containerRule{
+	{
+		runtime: "docker",
+		pattern: regexp.MustCompile(`^(?P<root>/.*)/containers/(?P<container_id>[0-9a-f]{64})(/|$)`),
+		stateFile: func(g map[string]string) string {
+			return path.Join(g["root"], "containers", g["container_id"], "config.v2.json")
+		},
+		name: dockerName,
+	},
+	{
+		runtime: "docker",
+		pattern: regexp.MustCompile(`^/.*/docker/volumes/(?P<volume_name>[^/]+)/_data(/|$)`),
+	},
+	{
+		runtime: "containerd",
+		pattern: regexp.MustCompile(`^(?P<root>/.*/io\.containerd\.runtime\.v[12]\.(task|linux))/(?P<containerd_namespace>[^/]+)/(?P<container_id>[^/]+)(/|$)`),
+		stateFile: func(g map[string]string) string {
+			return path.Join(g["root"], g["containerd_namespace"], g["container_id"], "config.json")
+		},
+		name: ociName,
+	},
+	{
+		runtime: "cri-o",
+		pattern: regexp.MustCompile(`^(?P<root>/.*/containers/storage/overlay-containers)/(?P<container_id>[0-9a-f]{64})(/|$)`),
+		stateFile: func(g map[string]string) string {
+			return path.Join(g["root"], g["container_id"], "userdata", "config.json")
+		},
+		name: ociName,
+	},
+	{
+		runtime: "cri-o",
+		pattern: regexp.MustCompile(`^/.*/containers/storage/volumes/(?P<volume_name>[^/]+)/_data(/|$)`),
+	},
+}
+
+// containerAttributor adds container_id, runtime and volume_name
+// attributes to filesystems mounted for containers
+type containerAttributor struct {
+	rules        []containerRule
+	resolveNames bool
+	readFile     func(string) ([]byte, error)
+}
+
+func newContainerAttributor(resolveNames bool) attributor {
+	return &containerAttributor{
+		rules:        containerRules,
+		resolveNames: resolveNames,
+		readFile:     ioutil.ReadFile,
+	}
+}
+
+// matchGroups returns values of named groups of pattern matched
+// against given string, nil is returned if string does not match
+func matchGroups(pattern *regexp.Regexp, s string) map[string]string {
+	match := pattern.FindStringSubmatch(s)
+	if match == nil {
+		return nil
+	}
+	groups := map[string]string{}
+	for i, name := range pattern.SubexpNames() {
+		if name != "" {
+			groups[name] = match[i]
+		}
+	}
+	return groups
+}
+
+func (ca *containerAttributor) attribute(dfm *dfMetric) {
+	for _, rule := range ca.rules {
+		groups := matchGroups(rule.pattern, dfm.UnchangedMountPoint)
+		if groups == nil {
+			continue
+		}
+		dfm.setAttribute("runtime", rule.runtime)
+		for _, key := range []string{"container_id", "volume_name", "containerd_namespace"} {
+			if groups[key] != "" {
+				dfm.setAttribute(key, groups[key])
+			}
+		}
+		if ca.resolveNames && rule.stateFile != nil {
+			if content, err := ca.readFile(rule.stateFile(groups)); err == nil {
+				if name := rule.name(content); name != "" {
+					dfm.setAttribute("container_name", name)
+				}
+			}
+		}
+		return
+	}
+}
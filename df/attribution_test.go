@@ -0,0 +1,112 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestContainerAttribution(t *testing.T) {
+	id := strings.Repeat("ab", 32)
+	Convey("Given container attributor", t, func() {
+		files := map[string]string{
+			"/var/lib/docker/containers/" + id + "/config.v2.json":                           `{"ID":"` + id + `","Name":"/web"}`,
+			"/run/containerd/io.containerd.runtime.v2.task/k8s.io/c1/config.json":            `{"annotations":{"io.kubernetes.cri.container-name":"nginx"}}`,
+			"/var/lib/containers/storage/overlay-containers/" + id + "/userdata/config.json": `{"annotations":{"io.kubernetes.cri-o.ContainerName":"k8s_app"}}`,
+		}
+		ca := newContainerAttributor(true).(*containerAttributor)
+		ca.readFile = func(file string) ([]byte, error) {
+			content, ok := files[file]
+			if !ok {
+				return nil, errors.New("no such file or directory")
+			}
+			return []byte(content), nil
+		}
+		attributes := func(mountPoint string) map[string]string {
+			dfms := []dfMetric{{UnchangedMountPoint: mountPoint}}
+			attribute([]attributor{ca}, dfms)
+			return dfms[0].Attributes
+		}
+
+		Convey("Then docker container mounts are attributed", func() {
+			attrs := attributes("/var/lib/docker/containers/" + id + "/mounts/shm")
+			So(attrs["runtime"], ShouldEqual, "docker")
+			So(attrs["container_id"], ShouldEqual, id)
+			So(attrs["container_name"], ShouldEqual, "web")
+		})
+
+		Convey("Then docker volumes are attributed", func() {
+			attrs := attributes("/var/lib/docker/volumes/pgdata/_data")
+			So(attrs["runtime"], ShouldEqual, "docker")
+			So(attrs["volume_name"], ShouldEqual, "pgdata")
+			So(attrs, ShouldNotContainKey, "container_id")
+		})
+
+		Convey("Then containerd task mounts are attributed", func() {
+			attrs := attributes("/run/containerd/io.containerd.runtime.v2.task/k8s.io/c1/rootfs")
+			So(attrs["runtime"], ShouldEqual, "containerd")
+			So(attrs["containerd_namespace"], ShouldEqual, "k8s.io")
+			So(attrs["container_id"], ShouldEqual, "c1")
+			So(attrs["container_name"], ShouldEqual, "nginx")
+		})
+
+		Convey("Then CRI-O container mounts are attributed", func() {
+			attrs := attributes("/run/containers/storage/overlay-containers/" + id + "/userdata/shm")
+			So(attrs["runtime"], ShouldEqual, "cri-o")
+			So(attrs["container_id"], ShouldEqual, id)
+			So(attrs, ShouldNotContainKey, "container_name")
+
+			attrs = attributes("/var/lib/containers/storage/overlay-containers/" + id + "/userdata/shm")
+			So(attrs["container_name"], ShouldEqual, "k8s_app")
+		})
+
+		Convey("Then other mounts are not attributed", func() {
+			So(attributes("/home"), ShouldBeNil)
+		})
+
+		Convey("Then attributes are reported as tags", func() {
+			dfm := dfMetric{UnchangedMountPoint: "/var/lib/docker/volumes/pgdata/_data"}
+			ca.attribute(&dfm)
+			So(createTags(dfm)["volume_name"], ShouldEqual, "pgdata")
+		})
+	})
+
+	Convey("Given attribution configuration", t, func() {
+		attributors, err := newAttributors("containers, ", false)
+		So(err, ShouldBeNil)
+		So(len(attributors), ShouldEqual, 1)
+
+		_, err = newAttributors("containers,pods", false)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, Attribution)
+
+		attributors, err = newAttributors(`["containers", "kubernetes"]`, false)
+		So(err, ShouldBeNil)
+		So(len(attributors), ShouldEqual, 2)
+
+		_, err = newAttributors(`["containers"`, false)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, Attribution+":")
+	})
+}
@@ -0,0 +1,213 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// prefix of device-mapper uuid for LVM logical volumes
+	dmUUIDLVMPrefix = "LVM-"
+	// prefix of device-mapper uuid for dm-crypt devices
+	dmUUIDCryptPrefix = "CRYPT-"
+	// size of sector used by sysfs size attribute
+	sysfsSectorSize = 512
+)
+
+// backingDisk describes physical disk backing filesystem
+type backingDisk struct {
+	Name       string
+	Size       uint64
+	Rotational bool
+	Model      string
+	Serial     string
+}
+
+// readSysfsString returns trimmed content of sysfs attribute,
+// empty string is returned if attribute can not be read
+func readSysfsString(file string) string {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// kernelDeviceName returns kernel name of block device (eg. dm-3)
+// identified by major:minor, empty string is returned for non block devices
+func kernelDeviceName(sysPath string, majorMinor string) string {
+	if majorMinor == "" {
+		return ""
+	}
+	link, err := os.Readlink(path.Join(sysPath, "dev", "block", majorMinor))
+	if err != nil {
+		return ""
+	}
+	return path.Base(link)
+}
+
+// splitLVMName splits device-mapper name of LVM logical volume into
+// volume group and logical volume names, LVM escapes dashes in names
+// by doubling them (eg. vg--0-data => vg-0, data)
+func splitLVMName(dmName string) (string, string) {
+	for i := 0; i < len(dmName); i++ {
+		if dmName[i] != '-' {
+			continue
+		}
+		if i+1 < len(dmName) && dmName[i+1] == '-' {
+			i++
+			continue
+		}
+		vg := strings.Replace(dmName[:i], "--", "-", -1)
+		lv := strings.Replace(dmName[i+1:], "--", "-", -1)
+		return vg, lv
+	}
+	return "", ""
+}
+
+// parentDevice returns name of whole disk for partition,
+// empty string is returned if device is not a partition
+func parentDevice(sysPath string, name string) string {
+	devPath := path.Join(sysPath, "class", "block", name)
+	if _, err := os.Stat(path.Join(devPath, "partition")); err != nil {
+		return ""
+	}
+	resolved, err := filepath.EvalSymlinks(devPath)
+	if err != nil {
+		return ""
+	}
+	return path.Base(path.Dir(resolved))
+}
+
+// slaveDevices returns names of devices underlying stacked device
+// (eg. device-mapper or md RAID)
+func slaveDevices(sysPath string, name string) []string {
+	slaves := []string{}
+	files, err := ioutil.ReadDir(path.Join(sysPath, "class", "block", name, "slaves"))
+	if err != nil {
+		return slaves
+	}
+	for _, f := range files {
+		slaves = append(slaves, f.Name())
+	}
+	return slaves
+}
+
+// leafDevices recursively follows slaves and partition parents
+// of block device and collects names of physical disks
+func leafDevices(sysPath string, name string, visited map[string]bool, leaves map[string]bool) {
+	if visited[name] {
+		return
+	}
+	visited[name] = true
+	if parent := parentDevice(sysPath, name); parent != "" {
+		leafDevices(sysPath, parent, visited, leaves)
+		return
+	}
+	slaves := slaveDevices(sysPath, name)
+	if len(slaves) == 0 {
+		leaves[name] = true
+		return
+	}
+	for _, slave := range slaves {
+		leafDevices(sysPath, slave, visited, leaves)
+	}
+}
+
+// backingDisks returns physical disks backing block device, sorted by name
+func backingDisks(sysPath string, name string) []backingDisk {
+	leaves := map[string]bool{}
+	leafDevices(sysPath, name, map[string]bool{}, leaves)
+	names := []string{}
+	for leaf := range leaves {
+		names = append(names, leaf)
+	}
+	sort.Strings(names)
+	disks := []backingDisk{}
+	for _, leaf := range names {
+		devPath := path.Join(sysPath, "class", "block", leaf)
+		disk := backingDisk{
+			Name:       leaf,
+			Rotational: readSysfsString(path.Join(devPath, "queue", "rotational")) == "1",
+			Model:      readSysfsString(path.Join(devPath, "device", "model")),
+			Serial:     readSysfsString(path.Join(devPath, "device", "serial")),
+		}
+		if sectors, err := strconv.ParseUint(readSysfsString(path.Join(devPath, "size")), 10, 64); err == nil {
+			disk.Size = sectors * sysfsSectorSize
+		}
+		disks = append(disks, disk)
+	}
+	return disks
+}
+
+// backingDisksTags returns comma separated lists of backing disks attributes,
+// all lists keep the order of disks in backing_disks tag
+func backingDisksTags(disks []backingDisk) map[string]string {
+	var names, sizes, rotationals, models, serials []string
+	clean := func(v string) string { return strings.Replace(v, ",", " ", -1) }
+	for _, disk := range disks {
+		names = append(names, disk.Name)
+		sizes = append(sizes, strconv.FormatUint(disk.Size, 10))
+		rotationals = append(rotationals, strconv.FormatBool(disk.Rotational))
+		models = append(models, clean(disk.Model))
+		serials = append(serials, clean(disk.Serial))
+	}
+	return map[string]string{
+		"backing_disks":            strings.Join(names, ","),
+		"backing_disks_size":       strings.Join(sizes, ","),
+		"backing_disks_rotational": strings.Join(rotationals, ","),
+		"backing_disks_model":      strings.Join(models, ","),
+		"backing_disks_serial":     strings.Join(serials, ","),
+	}
+}
+
+// Function to fill block device attributes of metric from sysfs
+func fillBlockDevice(sysPath string, dfm *dfMetric) {
+	dfm.DeviceKernelName = kernelDeviceName(sysPath, dfm.MajorMinor)
+	if dfm.DeviceKernelName == "" {
+		return
+	}
+	dfm.BackingDisks = backingDisks(sysPath, dfm.DeviceKernelName)
+	if strings.HasPrefix(dfm.DeviceKernelName, "loop") {
+		fillLoopDevice(sysPath, dfm)
+	}
+	dmPath := path.Join(sysPath, "dev", "block", dfm.MajorMinor, "dm")
+	dfm.DMName = readSysfsString(path.Join(dmPath, "name"))
+	if dfm.DMName == "" {
+		return
+	}
+	uuid := readSysfsString(path.Join(dmPath, "uuid"))
+	switch {
+	case strings.HasPrefix(uuid, dmUUIDLVMPrefix):
+		dfm.LVMVG, dfm.LVMLV = splitLVMName(dfm.DMName)
+	case strings.HasPrefix(uuid, dmUUIDCryptPrefix):
+		// CRYPT-<type>-<uuid>-<name>, eg. CRYPT-LUKS2-3f1a...-luks-home
+		dfm.Crypt = strings.SplitN(strings.TrimPrefix(uuid, dmUUIDCryptPrefix), "-", 2)[0]
+	}
+}
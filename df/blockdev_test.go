@@ -0,0 +1,151 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeSysfs describes block device exposed in fake sysfs tree
+type fakeSysfs struct {
+	root string
+}
+
+func newFakeSysfs() *fakeSysfs {
+	root, _ := ioutil.TempDir("", "df-sysfs")
+	return &fakeSysfs{root: root}
+}
+
+// addDevice adds block device with given attributes (relative to device directory),
+// device is not linked in dev/block when majorMinor is empty
+func (fs *fakeSysfs) addDevice(majorMinor string, devPath string, attrs map[string]string) {
+	devDir := filepath.Join(fs.root, "devices", devPath)
+	os.MkdirAll(devDir, 0755)
+	for attr, value := range attrs {
+		os.MkdirAll(filepath.Dir(filepath.Join(devDir, attr)), 0755)
+		ioutil.WriteFile(filepath.Join(devDir, attr), []byte(value+"\n"), 0644)
+	}
+	if majorMinor != "" {
+		os.MkdirAll(filepath.Join(fs.root, "dev", "block"), 0755)
+		os.Symlink(filepath.Join("..", "..", "devices", devPath), filepath.Join(fs.root, "dev", "block", majorMinor))
+	}
+	os.MkdirAll(filepath.Join(fs.root, "class", "block"), 0755)
+	os.Symlink(filepath.Join("..", "..", "devices", devPath), filepath.Join(fs.root, "class", "block", filepath.Base(devPath)))
+}
+
+// addSlaves links underlying devices of stacked device
+func (fs *fakeSysfs) addSlaves(name string, slaves ...string) {
+	slavesDir := filepath.Join(fs.root, "class", "block", name, "slaves")
+	os.MkdirAll(slavesDir, 0755)
+	for _, slave := range slaves {
+		os.Symlink(filepath.Join("..", "..", slave), filepath.Join(slavesDir, slave))
+	}
+}
+
+func (fs *fakeSysfs) cleanup() {
+	os.RemoveAll(fs.root)
+}
+
+func TestBlockDevice(t *testing.T) {
+	Convey("Given sysfs with device-mapper devices", t, func() {
+		sys := newFakeSysfs()
+		defer sys.cleanup()
+		sys.addDevice("253:3", "virtual/block/dm-3", map[string]string{
+			"dm/name": "vg--0-data",
+			"dm/uuid": "LVM-Ab3dEf",
+		})
+		sys.addDevice("253:4", "virtual/block/dm-4", map[string]string{
+			"dm/name": "luks-home",
+			"dm/uuid": "CRYPT-LUKS2-3f1a7b2c-luks-home",
+		})
+
+		Convey("Then LVM volume is resolved", func() {
+			dfm := dfMetric{MajorMinor: "253:3"}
+			fillBlockDevice(sys.root, &dfm)
+			So(dfm.DeviceKernelName, ShouldEqual, "dm-3")
+			So(dfm.DMName, ShouldEqual, "vg--0-data")
+			So(dfm.LVMVG, ShouldEqual, "vg-0")
+			So(dfm.LVMLV, ShouldEqual, "data")
+			So(dfm.Crypt, ShouldBeEmpty)
+		})
+
+		Convey("Then dm-crypt device is resolved", func() {
+			dfm := dfMetric{MajorMinor: "253:4"}
+			fillBlockDevice(sys.root, &dfm)
+			So(dfm.DeviceKernelName, ShouldEqual, "dm-4")
+			So(dfm.DMName, ShouldEqual, "luks-home")
+			So(dfm.Crypt, ShouldEqual, "LUKS2")
+			So(dfm.LVMVG, ShouldBeEmpty)
+		})
+
+		Convey("Then partition is backed by its disk", func() {
+			sys.addDevice("8:0", "pci0000:00/block/sda", map[string]string{
+				"size":             "976773168",
+				"queue/rotational": "1",
+				"device/model":     "WDC WD5000",
+				"device/serial":    "WD-123",
+			})
+			sys.addDevice("8:1", "pci0000:00/block/sda/sda1", map[string]string{"partition": "1"})
+			dfm := dfMetric{MajorMinor: "8:1"}
+			fillBlockDevice(sys.root, &dfm)
+			So(len(dfm.BackingDisks), ShouldEqual, 1)
+			So(dfm.DeviceKernelName, ShouldEqual, "sda1")
+			So(dfm.DMName, ShouldBeEmpty)
+			So(dfm.BackingDisks[0], ShouldResemble, backingDisk{
+				Name:       "sda",
+				Size:       976773168 * 512,
+				Rotational: true,
+				Model:      "WDC WD5000",
+				Serial:     "WD-123",
+			})
+			tags := createTags(dfm)
+			So(tags["backing_disks"], ShouldEqual, "sda")
+			So(tags["backing_disks_rotational"], ShouldEqual, "true")
+		})
+
+		Convey("Then LVM on md RAID is resolved to physical disks", func() {
+			for _, disk := range []string{"sdb", "sdc"} {
+				sys.addDevice("", "pci0000:00/block/"+disk, map[string]string{"queue/rotational": "0"})
+				sys.addDevice("", "pci0000:00/block/"+disk+"/"+disk+"1", map[string]string{"partition": "1"})
+			}
+			sys.addDevice("9:0", "virtual/block/md0", map[string]string{})
+			sys.addSlaves("md0", "sdb1", "sdc1")
+			sys.addSlaves("dm-3", "md0")
+			dfm := dfMetric{MajorMinor: "253:3"}
+			fillBlockDevice(sys.root, &dfm)
+			So(len(dfm.BackingDisks), ShouldEqual, 2)
+			tags := createTags(dfm)
+			So(tags["backing_disks"], ShouldEqual, "sdb,sdc")
+			So(tags["backing_disks_rotational"], ShouldEqual, "false,false")
+		})
+
+		Convey("Then non block device is skipped", func() {
+			dfm := dfMetric{MajorMinor: "0:50"}
+			fillBlockDevice(sys.root, &dfm)
+			So(dfm.DeviceKernelName, ShouldBeEmpty)
+			So(createTags(dfm), ShouldNotContainKey, "device_kernel_name")
+		})
+	})
+}
@@ -0,0 +1,166 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/intelsdi-x/snap/control/plugin"
+	"github.com/intelsdi-x/snap/core"
+)
+
+const (
+	// only dynamic metric types are listed (eg. /intel/procfs/filesystem/*/space_free)
+	catalogWildcard = "wildcard"
+	// only metric types of currently mounted filesystems are listed
+	catalogConcrete = "concrete"
+	// both dynamic and concrete metric types are listed
+	catalogBoth = "both"
+)
+
+// units of filesystem metrics by kind
+var metricUnits = map[string]string{
+	"space_free":              "KB",
+	"space_reserved":          "KB",
+	"space_used":              "KB",
+	"space_total":             "KB",
+	"space_percent_free":      "%",
+	"space_percent_reserved":  "%",
+	"space_percent_used":      "%",
+	"inodes_free":             "inodes",
+	"inodes_reserved":         "inodes",
+	"inodes_used":             "inodes",
+	"inodes_total":            "inodes",
+	"inodes_percent_free":     "%",
+	"inodes_percent_reserved": "%",
+	"inodes_percent_used":     "%",
+	"cache_age_seconds":       "s",
+	"md_devices_active":       "devices",
+	"md_devices_failed":       "devices",
+	"md_devices_spare":        "devices",
+	"md_degraded":             "devices",
+	"md_sync_percent":         "%",
+	"md_sync_speed":           "KB/s",
+	"overlay_upper_bytes":     "B",
+	"overlay_upper_inodes":    "inodes",
+	"space_deleted_open":      "KB",
+	"open_files":              "files",
+	"processes_using":         "processes",
+}
+
+// units of quota metrics by kind
+var quotaMetricUnits = map[string]string{
+	"space_used":           "KB",
+	"space_soft_limit":     "KB",
+	"space_hard_limit":     "KB",
+	"space_grace_seconds":  "s",
+	"inodes_used":          "inodes",
+	"inodes_soft_limit":    "inodes",
+	"inodes_hard_limit":    "inodes",
+	"inodes_grace_seconds": "s",
+}
+
+// units of aggregate metrics by kind
+var aggregateMetricUnits = map[string]string{
+	"space_total":             "KB",
+	"space_free":              "KB",
+	"space_reserved":          "KB",
+	"space_used":              "KB",
+	"space_percent_used_max":  "%",
+	"inodes_total":            "inodes",
+	"inodes_free":             "inodes",
+	"inodes_reserved":         "inodes",
+	"inodes_used":             "inodes",
+	"inodes_percent_used_max": "%",
+	"mounts":                  "mounts",
+}
+
+// units of metrics of watched directories by kind
+var directoryMetricUnits = map[string]string{
+	"dir_bytes":  "B",
+	"dir_inodes": "inodes",
+	"dir_files":  "files",
+}
+
+// metrics which are filled only when requested, so they are
+// listed for every filesystem in concrete catalog
+var onDemandMetricsKind = map[string]bool{
+	"space_deleted_open": true,
+	"open_files":         true,
+	"processes_using":    true,
+}
+
+// validateCatalogMode returns error if value of catalog_mode is not valid
+func validateCatalogMode(mode string) error {
+	switch mode {
+	case catalogWildcard, catalogConcrete, catalogBoth:
+		return nil
+	}
+	return fmt.Errorf("%s: wrong value %q, expected one of %s, %s, %s",
+		CatalogMode, mode, catalogWildcard, catalogConcrete, catalogBoth)
+}
+
+// metricUnit returns unit of metric looked up by its family, as the same
+// kind (eg. space_used) may be reported in different units by different families,
+// metrics without unit (eg. device_name) have empty unit
+func metricUnit(ns core.Namespace) string {
+	kind := ns[len(ns)-1].Value
+	switch {
+	case isDirectoryNamespace(ns):
+		return directoryMetricUnits[kind]
+	case isQuotaNamespace(ns):
+		return quotaMetricUnits[kind]
+	case isAggregateNamespace(ns):
+		return aggregateMetricUnits[kind]
+	}
+	return metricUnits[kind]
+}
+
+// Function to set units of metric types
+func setUnits(mts []plugin.MetricType) {
+	for i := range mts {
+		mts[i].Unit_ = metricUnit(mts[i].Namespace())
+	}
+}
+
+// concreteMetricTypes returns metric types of given filesystems named the same way
+// as by collection, usage of overlay writable layers is listed for overlays if
+// walkOverlay is set
+func concreteMetricTypes(dfms []dfMetric, walkOverlay bool) []plugin.MetricType {
+	mts := []plugin.MetricType{}
+	for _, dfm := range dfms {
+		for _, kind := range metricsKind {
+			onDemand := onDemandMetricsKind[kind] ||
+				walkOverlay && strings.HasPrefix(kind, "overlay_upper_") && dfm.Overlay != nil && dfm.Overlay.UpperDir != ""
+			if !hasMetric(kind, dfm) && !onDemand {
+				continue
+			}
+			mts = append(mts, plugin.MetricType{
+				Namespace_: core.NewNamespace(createNamespace(dfm.MountPoint, kind)...),
+				Description_: fmt.Sprintf("%s of %s (%s) mounted on %s",
+					kind, dfm.Filesystem, dfm.FsType, dfm.UnchangedMountPoint),
+			})
+		}
+	}
+	return mts
+}
@@ -0,0 +1,104 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCatalog(t *testing.T) {
+	Convey("Given mounted filesystems", t, func() {
+		dfms := []dfMetric{
+			{Filesystem: "/dev/md0", FsType: "xfs", MountPoint: "srv", UnchangedMountPoint: "/srv", MdRaid: &mdInfo{Name: "md0"}},
+			{Filesystem: "tmpfs", FsType: "tmpfs", MountPoint: "run", UnchangedMountPoint: "/run"},
+		}
+
+		Convey("When concrete metric types are listed", func() {
+			mts := concreteMetricTypes(dfms, false)
+			setUnits(mts)
+			ns := map[string]string{}
+			for _, m := range mts {
+				ns[m.Namespace().String()] = m.Unit()
+			}
+
+			Convey("Then only metrics available for filesystem are listed", func() {
+				So(ns, ShouldContainKey, "/intel/procfs/filesystem/srv/md_degraded")
+				So(ns, ShouldNotContainKey, "/intel/procfs/filesystem/run/md_degraded")
+				So(ns, ShouldNotContainKey, "/intel/procfs/filesystem/run/overlay_upper_bytes")
+				So(ns, ShouldContainKey, "/intel/procfs/filesystem/run/processes_using")
+			})
+
+			Convey("Then metrics carry units", func() {
+				So(ns["/intel/procfs/filesystem/srv/md_sync_speed"], ShouldEqual, "KB/s")
+				So(ns["/intel/procfs/filesystem/run/inodes_used"], ShouldEqual, "inodes")
+				So(ns["/intel/procfs/filesystem/run/device_name"], ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given filesystems with original mount points kept", t, func() {
+		dfms := []dfMetric{
+			{Filesystem: "/dev/sda1", FsType: "ext4", MountPoint: "/", UnchangedMountPoint: "/"},
+			{Filesystem: "/dev/sda2", FsType: "ext4", MountPoint: "/var/lib", UnchangedMountPoint: "/var/lib"},
+			{Filesystem: "/dev/sda3", FsType: "ext4", MountPoint: "/var_lib", UnchangedMountPoint: "/var_lib"},
+			{Filesystem: "/dev/sdb1", FsType: "xfs", MountPoint: "dev_sdb1", UnchangedMountPoint: "/data", KeyedBy: namespaceKeyDevice},
+		}
+
+		Convey("When concrete metric types are listed", func() {
+			names := map[string]int{}
+			for _, m := range concreteMetricTypes(dfms, false) {
+				names[m.Namespace()[3].Value]++
+			}
+
+			Convey("Then names used by collection are listed", func() {
+				kinds := len(concreteMetricTypes(dfms[:1], false))
+				So(names, ShouldResemble, map[string]int{"/": kinds, "/var/lib": kinds, "/var_lib": kinds, "dev_sdb1": kinds})
+			})
+		})
+	})
+
+	Convey("Given metric types of all families", t, func() {
+		mts := append(quotaMetricTypes(), aggregateMetricTypes()...)
+		mts = append(mts, directoryMetricTypes()...)
+		setUnits(mts)
+		units := map[string]string{}
+		for _, m := range mts {
+			units[m.Namespace().String()] = m.Unit()
+		}
+
+		Convey("Then units are looked up by family", func() {
+			So(units["/intel/procfs/filesystem/*/quota/*/*/space_used"], ShouldEqual, "KB")
+			So(units["/intel/procfs/filesystem/*/quota/*/*/space_hard_limit"], ShouldEqual, "KB")
+			So(units["/intel/procfs/filesystem/*/quota/*/*/space_grace_seconds"], ShouldEqual, "s")
+			So(units["/intel/procfs/filesystem/_total/mounts"], ShouldEqual, "mounts")
+			So(units["/intel/procfs/filesystem/_total/space_used"], ShouldEqual, "KB")
+			So(units["/intel/procfs/filesystem/directory/*/dir_bytes"], ShouldEqual, "B")
+		})
+	})
+
+	Convey("Given catalog mode configuration", t, func() {
+		So(validateCatalogMode(catalogWildcard), ShouldBeNil)
+		So(validateCatalogMode(catalogConcrete), ShouldBeNil)
+		So(validateCatalogMode(catalogBoth), ShouldBeNil)
+		So(validateCatalogMode("none"), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,197 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/intelsdi-x/snap/control/plugin"
+	"github.com/intelsdi-x/snap/core/cdata"
+	log "github.com/sirupsen/logrus"
+)
+
+// limit of distinct configurations kept compiled, all of them are dropped
+// when exceeded (eg. after many tasks with different settings were created)
+const dfltMaxConfigs = 64
+
+// configKey returns hash of configuration items, requests with the same
+// configuration share compiled settings; empty key is returned for requests
+// without configuration
+func configKey(node *cdata.ConfigDataNode) string {
+	if node == nil {
+		return ""
+	}
+	table := node.Table()
+	if len(table) == 0 {
+		return ""
+	}
+	keys := []string{}
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	h := fnv.New64a()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s=%#v\n", key, table[key])
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// groupByConfig groups requested metric types by their configuration,
+// keys are returned in order of first request using them
+func groupByConfig(mts []plugin.MetricType) ([]string, map[string][]plugin.MetricType) {
+	keys := []string{}
+	groups := map[string][]plugin.MetricType{}
+	for _, m := range mts {
+		key := configKey(m.Config())
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], m)
+	}
+	return keys, groups
+}
+
+// configured returns collector with settings of given configuration, settings
+// of plugin are used for requests without configuration and as defaults
+// for items missing in configuration
+func (p *dfCollector) configured(key string, cfg interface{}) (*dfCollector, error) {
+	if key == "" {
+		return p, nil
+	}
+	p.configsMutex.Lock()
+	defer p.configsMutex.Unlock()
+	if c, ok := p.configs[key]; ok {
+		return c, nil
+	}
+	c := *p
+	c.configs = nil
+	// Cache of filesystems is replaced by each collection, so configurations
+	// reading different mounts or with different refresh intervals cannot share it
+	if _, ok := p.stats.(*dfStats); ok {
+		c.stats = &dfStats{cache: map[string]dfMetric{}}
+	}
+	if err := c.setProcPath(cfg); err != nil {
+		return nil, err
+	}
+	if len(p.configs) >= dfltMaxConfigs {
+		log.Debug(fmt.Sprintf("Dropping %d compiled configurations", len(p.configs)))
+		p.configs = map[string]*dfCollector{}
+	}
+	p.configs[key] = &c
+	return &c, nil
+}
+
+// parseList returns items of list-typed configuration, given either as JSON
+// array of strings (eg. ["/mnt/a,b", "/srv"]) or as comma-separated string;
+// whitespace around items is trimmed and empty items are skipped
+func parseList(key string, value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	raw := []string{}
+	if strings.HasPrefix(value, "[") {
+		if err := json.Unmarshal([]byte(value), &raw); err != nil {
+			return nil, fmt.Errorf("%s: wrong value %q, expected JSON array of strings or comma-separated list: %s", key, value, err)
+		}
+	} else {
+		raw = strings.Split(value, ",")
+	}
+	items := []string{}
+	for _, item := range raw {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// warnRelativeMountPoints logs excluded mount points which are not absolute
+// paths, they never match mount points listed in mountinfo
+func warnRelativeMountPoints(key string, mountPoints []string) {
+	for _, mountPoint := range mountPoints {
+		if !filepath.IsAbs(mountPoint) {
+			log.Warn(fmt.Sprintf("%s: %q is not absolute path of mount point, it excludes nothing", key, mountPoint))
+		}
+	}
+}
+
+// knownFSTypes returns filesystem types supported by kernel
+func knownFSTypes(procPath string) (map[string]bool, error) {
+	fh, err := os.Open(path.Join(procPath, "filesystems"))
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	types := map[string]bool{}
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		// eg. "nodev\tsysfs" or "\text4"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 {
+			types[fields[len(fields)-1]] = true
+		}
+	}
+	return types, scanner.Err()
+}
+
+// pseudoFSTypes are shown in mountinfo but not listed in /proc/filesystems
+var pseudoFSTypes = map[string]bool{
+	"none": true,
+}
+
+// unknownFSTypes returns filesystem types not supported by kernel, FUSE
+// subtypes (eg. fuse.sshfs) are supported if fuse is, pseudo types and types
+// excluded by default are skipped as they are not given by user
+func unknownFSTypes(known map[string]bool, fsTypes []string) []string {
+	unknown := []string{}
+	for _, fsType := range fsTypes {
+		base := fsType
+		if i := strings.Index(fsType, "."); i > 0 {
+			base = fsType[:i]
+		}
+		if known[base] || pseudoFSTypes[fsType] || excludedFSFromList(fsType, dfltExcludedFSTypes) {
+			continue
+		}
+		unknown = append(unknown, fsType)
+	}
+	return unknown
+}
+
+// warnUnknownFSTypes logs filesystem types not supported by kernel, they are
+// not reported as error because modules of filesystems are loaded on demand
+func warnUnknownFSTypes(key string, procPath string, fsTypes []string) {
+	known, err := knownFSTypes(procPath)
+	if err != nil {
+		log.Debug(fmt.Sprintf("Unable to check %s: %s", key, err))
+		return
+	}
+	for _, fsType := range unknownFSTypes(known, fsTypes) {
+		log.Warn(fmt.Sprintf("%s: filesystem type %q is not listed in %s", key, fsType, path.Join(procPath, "filesystems")))
+	}
+}
@@ -0,0 +1,218 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/intelsdi-x/snap/control/plugin"
+	"github.com/intelsdi-x/snap/core"
+	"github.com/intelsdi-x/snap/core/cdata"
+	"github.com/intelsdi-x/snap/core/ctypes"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfigured(t *testing.T) {
+	Convey("Given configurations of tasks", t, func() {
+		keep := cdata.NewNode()
+		keep.AddItem(KeepOriginalMountPoint, ctypes.ConfigValueBool{Value: true})
+		sanitize := cdata.NewNode()
+		sanitize.AddItem(KeepOriginalMountPoint, ctypes.ConfigValueBool{Value: false})
+		sanitize.AddItem(ExcludedFSNames, ctypes.ConfigValueStr{Value: "/boot"})
+		same := cdata.NewNode()
+		same.AddItem(ExcludedFSNames, ctypes.ConfigValueStr{Value: "/boot"})
+		same.AddItem(KeepOriginalMountPoint, ctypes.ConfigValueBool{Value: false})
+
+		Convey("Then configurations are keyed by their items", func() {
+			So(configKey(nil), ShouldBeEmpty)
+			So(configKey(cdata.NewNode()), ShouldBeEmpty)
+			So(configKey(sanitize), ShouldEqual, configKey(same))
+			So(configKey(sanitize), ShouldNotEqual, configKey(keep))
+		})
+
+		Convey("Then requests are grouped by configuration", func() {
+			ns := core.NewNamespace("intel", "procfs", "filesystem", "*", "space_free")
+			mts := []plugin.MetricType{
+				{Namespace_: ns, Config_: keep},
+				{Namespace_: ns, Config_: sanitize},
+				{Namespace_: ns, Config_: same},
+				{Namespace_: ns},
+			}
+			keys, groups := groupByConfig(mts)
+			So(keys, ShouldResemble, []string{configKey(keep), configKey(sanitize), ""})
+			So(len(groups[configKey(sanitize)]), ShouldEqual, 2)
+		})
+
+		Convey("When collector is configured for each task", func() {
+			p := NewDfCollector()
+			first, err := p.configured(configKey(sanitize), plugin.MetricType{Config_: sanitize})
+			So(err, ShouldBeNil)
+			second, err := p.configured(configKey(keep), plugin.MetricType{Config_: keep})
+			So(err, ShouldBeNil)
+
+			Convey("Then each task gets its own settings", func() {
+				So(first.keep_original_mountpoint, ShouldBeFalse)
+				So(first.excluded_fs_names, ShouldResemble, []string{"/boot"})
+				So(second.keep_original_mountpoint, ShouldBeTrue)
+				So(p.excluded_fs_names, ShouldResemble, dfltExcludedFSNames)
+			})
+
+			Convey("Then compiled settings are reused", func() {
+				again, _ := p.configured(configKey(same), plugin.MetricType{Config_: same})
+				So(again, ShouldEqual, first)
+				self, _ := p.configured("", plugin.MetricType{})
+				So(self, ShouldEqual, p)
+			})
+
+			Convey("Then wrong configuration is not kept", func() {
+				wrong := cdata.NewNode()
+				wrong.AddItem(MetricLayout, ctypes.ConfigValueStr{Value: "flat"})
+				_, err := p.configured(configKey(wrong), plugin.MetricType{Config_: wrong})
+				So(err, ShouldNotBeNil)
+				So(p.configs, ShouldNotContainKey, configKey(wrong))
+			})
+		})
+
+		Convey("When tasks read different procfs", func() {
+			p := NewDfCollector()
+			roots := []string{}
+			mts := []plugin.MetricType{}
+			for i := 0; i < 2; i++ {
+				root, _ := ioutil.TempDir("", "df-configured")
+				defer os.RemoveAll(root)
+				roots = append(roots, root)
+				node := cdata.NewNode()
+				node.AddItem(ProcPath, ctypes.ConfigValueStr{Value: makeMounts(root, 2)})
+				node.AddItem(RefreshIntervals, ctypes.ConfigValueStr{Value: "ext4=1h"})
+				m := requestOf("*", "space_free")[0]
+				m.Config_ = node
+				mts = append(mts, m)
+			}
+			for _, m := range mts {
+				_, err := p.CollectMetrics([]plugin.MetricType{m})
+				So(err, ShouldBeNil)
+			}
+
+			Convey("Then each configuration keeps its own cached filesystems", func() {
+				for i, m := range mts {
+					c, _ := p.configured(configKey(m.Config_), m)
+					cache := c.stats.(*dfStats).cache
+					So(len(cache), ShouldEqual, 2)
+					So(cache, ShouldContainKey, filepath.Join(roots[i], "mnt", "m00000"))
+					So(cache, ShouldContainKey, filepath.Join(roots[i], "mnt", "m00001"))
+				}
+				So(p.stats.(*dfStats).cache, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestParseList(t *testing.T) {
+	Convey("Given list-typed configuration", t, func() {
+		Convey("Then comma-separated items are trimmed", func() {
+			items, err := parseList(ExcludedFSTypes, " tmpfs, proc ,,sysfs ")
+			So(err, ShouldBeNil)
+			So(items, ShouldResemble, []string{"tmpfs", "proc", "sysfs"})
+		})
+
+		Convey("Then JSON array may list items containing commas", func() {
+			items, err := parseList(ExcludedFSNames, `["/mnt/a,b", " /srv "]`)
+			So(err, ShouldBeNil)
+			So(items, ShouldResemble, []string{"/mnt/a,b", "/srv"})
+		})
+
+		Convey("Then empty list is accepted", func() {
+			items, err := parseList(ExcludedFSNames, "")
+			So(err, ShouldBeNil)
+			So(items, ShouldBeEmpty)
+			items, err = parseList(ExcludedFSNames, "[]")
+			So(err, ShouldBeNil)
+			So(items, ShouldBeEmpty)
+		})
+
+		Convey("Then malformed JSON array is reported with configuration key", func() {
+			_, err := parseList(ExcludedFSNames, `["/mnt", 1]`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, ExcludedFSNames+": wrong value")
+		})
+	})
+}
+
+func TestConfigValidation(t *testing.T) {
+	Convey("Given fake procfs", t, func() {
+		procPath, _ := ioutil.TempDir("", "df-config")
+		defer os.RemoveAll(procPath)
+		ioutil.WriteFile(filepath.Join(procPath, "filesystems"), []byte("nodev\tsysfs\nnodev\ttmpfs\n\text4\n"), 0644)
+
+		Convey("Then filesystem types supported by kernel are read", func() {
+			known, err := knownFSTypes(procPath)
+			So(err, ShouldBeNil)
+			So(known, ShouldResemble, map[string]bool{"sysfs": true, "tmpfs": true, "ext4": true})
+		})
+
+		Convey("Then only types given by user and not supported by kernel are unknown", func() {
+			known := map[string]bool{"ext4": true, "fuse": true}
+			So(unknownFSTypes(known, []string{"ext4", "fuse.sshfs", "none", "ext5", "fuse.gvfsd-fuse", "mqueue"}),
+				ShouldResemble, []string{"ext5"})
+			So(unknownFSTypes(known, dfltExcludedFSTypes), ShouldBeEmpty)
+			So(unknownFSTypes(map[string]bool{"ext4": true}, []string{"fuse.sshfs"}), ShouldResemble, []string{"fuse.sshfs"})
+		})
+
+		Convey("When procfs does not list mounts", func() {
+			node := cdata.NewNode()
+			node.AddItem(ProcPath, ctypes.ConfigValueStr{Value: procPath})
+			err := NewDfCollector().setProcPath(plugin.ConfigType{ConfigDataNode: node})
+
+			Convey("Then error names configuration key", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, ProcPath+":")
+				So(err.Error(), ShouldContainSubstring, "mountinfo")
+			})
+		})
+
+		Convey("When procfs lists mounts", func() {
+			os.MkdirAll(filepath.Join(procPath, "1"), 0755)
+			ioutil.WriteFile(filepath.Join(procPath, "1", MountInfoFile), []byte{}, 0644)
+			node := cdata.NewNode()
+			node.AddItem(ProcPath, ctypes.ConfigValueStr{Value: procPath})
+			node.AddItem(ExcludedFSTypes, ctypes.ConfigValueStr{Value: `["tmpfs", "ext5"]`})
+			node.AddItem(ExcludedFSNames, ctypes.ConfigValueStr{Value: `["/mnt/a,b"]`})
+			p := NewDfCollector()
+			err := p.setProcPath(plugin.ConfigType{ConfigDataNode: node})
+
+			Convey("Then lists are set and unknown types are only warned about", func() {
+				So(err, ShouldBeNil)
+				So(p.excluded_fs_types, ShouldResemble, []string{"tmpfs", "ext5"})
+				So(p.excluded_fs_names, ShouldResemble, []string{"/mnt/a,b"})
+			})
+		})
+
+		Convey("When system paths are not directories", func() {
+			node := cdata.NewNode()
+			node.AddItem(SysPath, ctypes.ConfigValueStr{Value: filepath.Join(procPath, "filesystems")})
+			err := NewDfCollector().setProcPath(plugin.ConfigType{ConfigDataNode: node})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, SysPath+":")
+		})
+	})
+}
@@ -0,0 +1,119 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// every mount is reported
+	deduplicateOff = "off"
+	// mounts with the same device number are reported once
+	deduplicateDevice = "device"
+	// mounts with the same filesystem ID are reported once
+	deduplicateFSID = "fsid"
+
+	// mount with the shortest mount point is reported
+	preferShortest = "shortest"
+	// mount listed first in mountinfo is reported
+	preferFirst = "first"
+	// mount of root of filesystem is reported, bind mounts of its subdirectories are aliases
+	preferRoot = "root"
+)
+
+// validateDeduplicate returns error if values of deduplicate options are not valid
+func validateDeduplicate(mode string, prefer string) error {
+	switch mode {
+	case deduplicateOff, deduplicateDevice, deduplicateFSID:
+	default:
+		return fmt.Errorf("%s: wrong value %q, expected one of %s, %s, %s",
+			Deduplicate, mode, deduplicateOff, deduplicateDevice, deduplicateFSID)
+	}
+	switch prefer {
+	case preferShortest, preferFirst, preferRoot:
+		return nil
+	}
+	return fmt.Errorf("%s: wrong value %q, expected one of %s, %s, %s",
+		DeduplicatePrefer, prefer, preferShortest, preferFirst, preferRoot)
+}
+
+// Return identity of filesystem used to group mounts, empty if mount is not grouped
+func deduplicateKey(dfm dfMetric, mode string) string {
+	switch mode {
+	case deduplicateDevice:
+		return dfm.MajorMinor
+	case deduplicateFSID:
+		return dfm.FSID
+	}
+	return ""
+}
+
+// Return true if mount a should be reported instead of mount b
+func preferredMount(a dfMetric, b dfMetric, prefer string) bool {
+	switch prefer {
+	case preferFirst:
+		return false
+	case preferRoot:
+		if (a.MountRoot == "/") != (b.MountRoot == "/") {
+			return a.MountRoot == "/"
+		}
+	}
+	return len(a.UnchangedMountPoint) < len(b.UnchangedMountPoint)
+}
+
+// deduplicate reports filesystem mounted more than once (eg. bind mounts)
+// as one primary mount, mount points of other mounts become its aliases
+func deduplicate(dfms []dfMetric, mode string, prefer string) []dfMetric {
+	if mode == deduplicateOff || mode == "" {
+		return dfms
+	}
+	result := []dfMetric{}
+	primary := map[string]int{}
+	for _, dfm := range dfms {
+		key := deduplicateKey(dfm, mode)
+		if key == "" {
+			result = append(result, dfm)
+			continue
+		}
+		idx, ok := primary[key]
+		if !ok {
+			primary[key] = len(result)
+			result = append(result, dfm)
+			continue
+		}
+		if preferredMount(dfm, result[idx], prefer) {
+			dfm.Aliases, result[idx].Aliases = result[idx].Aliases, nil
+			dfm.Aliases = append(dfm.Aliases, result[idx].UnchangedMountPoint)
+			result[idx] = dfm
+			continue
+		}
+		result[idx].Aliases = append(result[idx].Aliases, dfm.UnchangedMountPoint)
+	}
+	return result
+}
+
+// aliasesTag returns mount points of aliases as comma separated list
+func aliasesTag(aliases []string) string {
+	return strings.Join(aliases, ",")
+}
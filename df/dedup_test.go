@@ -0,0 +1,87 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDeduplicate(t *testing.T) {
+	Convey("Given filesystem mounted more than once", t, func() {
+		dfms := []dfMetric{
+			{MajorMinor: "8:1", FSID: "1", MountRoot: "/var/lib/kubelet/pods/x/etc-hosts", UnchangedMountPoint: "/etc/hosts"},
+			{MajorMinor: "8:1", FSID: "1", MountRoot: "/", UnchangedMountPoint: "/"},
+			{MajorMinor: "8:2", FSID: "2", MountRoot: "/", UnchangedMountPoint: "/data"},
+			{MajorMinor: "8:1", FSID: "1", MountRoot: "/var/log", UnchangedMountPoint: "/mnt/log"},
+			{MajorMinor: "0:45", UnchangedMountPoint: "/proc/x"},
+		}
+
+		Convey("When shortest mount point is preferred", func() {
+			result := deduplicate(dfms, deduplicateDevice, preferShortest)
+
+			Convey("Then filesystem is reported once with aliases", func() {
+				So(len(result), ShouldEqual, 3)
+				So(result[0].UnchangedMountPoint, ShouldEqual, "/")
+				So(result[0].Aliases, ShouldResemble, []string{"/etc/hosts", "/mnt/log"})
+				So(createTags(result[0])["mount_aliases"], ShouldEqual, "/etc/hosts,/mnt/log")
+				So(result[1].Aliases, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When first mount is preferred", func() {
+			result := deduplicate(dfms, deduplicateDevice, preferFirst)
+			So(result[0].UnchangedMountPoint, ShouldEqual, "/etc/hosts")
+			So(result[0].Aliases, ShouldResemble, []string{"/", "/mnt/log"})
+		})
+
+		Convey("When mount of filesystem root is preferred", func() {
+			dfms[1].MountRoot = "/srv"
+			result := deduplicate(dfms, deduplicateDevice, preferRoot)
+			// no mount of root, the shortest one wins
+			So(result[0].UnchangedMountPoint, ShouldEqual, "/")
+			dfms[1].MountRoot = "/"
+			dfms[3].MountRoot = "/"
+			result = deduplicate(dfms, deduplicateDevice, preferRoot)
+			So(result[0].UnchangedMountPoint, ShouldEqual, "/")
+			So(result[0].Aliases, ShouldResemble, []string{"/etc/hosts", "/mnt/log"})
+		})
+
+		Convey("When mounts are grouped by filesystem ID", func() {
+			result := deduplicate(dfms, deduplicateFSID, preferShortest)
+
+			Convey("Then mounts without filesystem ID are kept", func() {
+				So(len(result), ShouldEqual, 3)
+				So(result[2].UnchangedMountPoint, ShouldEqual, "/proc/x")
+			})
+		})
+
+		Convey("When deduplication is off", func() {
+			So(len(deduplicate(dfms, deduplicateOff, preferShortest)), ShouldEqual, len(dfms))
+		})
+	})
+
+	Convey("Given deduplication configuration", t, func() {
+		So(validateDeduplicate(deduplicateDevice, preferRoot), ShouldBeNil)
+		So(validateDeduplicate("uuid", preferRoot), ShouldNotBeNil)
+		So(validateDeduplicate(deduplicateFSID, "longest"), ShouldNotBeNil)
+	})
+}
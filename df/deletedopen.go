@@ -0,0 +1,199 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var dfltDeletedOpenTopProcesses = 3
+
+// procUsage holds space held by deleted files opened by process
+type procUsage struct {
+	PID   int
+	Comm  string
+	Bytes uint64
+}
+
+// deletedOpen holds space held by deleted files which are still open
+type deletedOpen struct {
+	Bytes uint64
+	// processes holding the most space, sorted by held space
+	Processes []procUsage
+}
+
+// procUsageBySize sorts processes from the one holding the most space
+type procUsageBySize []procUsage
+
+func (p procUsageBySize) Len() int { return len(p) }
+func (p procUsageBySize) Less(i, j int) bool {
+	if p[i].Bytes != p[j].Bytes {
+		return p[i].Bytes > p[j].Bytes
+	}
+	return p[i].PID < p[j].PID
+}
+func (p procUsageBySize) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+// majorMinor returns device number in major:minor notation used by mountinfo
+func majorMinor(dev uint64) string {
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+	return fmt.Sprintf("%d:%d", major, minor)
+}
+
+// Return list of process IDs found in procfs
+func listPIDs(procPath string) []int {
+	entries, err := ioutil.ReadDir(procPath)
+	if err != nil {
+		return nil
+	}
+	pids := []int{}
+	for _, entry := range entries {
+		if pid, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// Return command name of process
+func processComm(procPath string, pid int) string {
+	return readSysfsString(path.Join(procPath, strconv.Itoa(pid), "comm"))
+}
+
+// scanDeletedOpen returns space held by deleted files opened by processes
+// by major:minor of device, file opened many times is counted once;
+// at most maxProcesses processes are scanned, 0 means no limit
+func scanDeletedOpen(procPath string, maxProcesses int) map[string]*deletedOpen {
+	usage := map[string]*deletedOpen{}
+	seen := map[fileID]bool{}
+	pids := listPIDs(procPath)
+	if maxProcesses > 0 && len(pids) > maxProcesses {
+		log.Debug(fmt.Sprintf("Scanning deleted files of only %d of %d processes", maxProcesses, len(pids)))
+		pids = pids[:maxProcesses]
+	}
+	for _, pid := range pids {
+		fdPath := path.Join(procPath, strconv.Itoa(pid), "fd")
+		fh, err := os.Open(fdPath)
+		if err != nil {
+			// process exited or is not accessible
+			continue
+		}
+		fds, _ := fh.Readdirnames(-1)
+		fh.Close()
+		held := map[string]uint64{}
+		seenByProcess := map[fileID]bool{}
+		for _, fd := range fds {
+			link := path.Join(fdPath, fd)
+			target, err := os.Readlink(link)
+			if err != nil || !strings.HasSuffix(target, " (deleted)") {
+				continue
+			}
+			// stat through descriptor reaches unlinked inode
+			fi, err := os.Stat(link)
+			if err != nil || !fi.Mode().IsRegular() {
+				continue
+			}
+			st, ok := fi.Sys().(*syscall.Stat_t)
+			if !ok {
+				continue
+			}
+			id := fileID{uint64(st.Dev), uint64(st.Ino)}
+			if seenByProcess[id] {
+				continue
+			}
+			seenByProcess[id] = true
+			bytes := uint64(st.Blocks) * 512
+			majmin := majorMinor(uint64(st.Dev))
+			held[majmin] += bytes
+			if usage[majmin] == nil {
+				usage[majmin] = &deletedOpen{}
+			}
+			if !seen[id] {
+				seen[id] = true
+				usage[majmin].Bytes += bytes
+			}
+		}
+		if len(held) == 0 {
+			continue
+		}
+		comm := processComm(procPath, pid)
+		for majmin, bytes := range held {
+			usage[majmin].Processes = append(usage[majmin].Processes, procUsage{PID: pid, Comm: comm, Bytes: bytes})
+		}
+	}
+	for _, du := range usage {
+		sort.Sort(procUsageBySize(du.Processes))
+	}
+	return usage
+}
+
+// scanDeleted returns space held by deleted files by major:minor of device,
+// it is limited by interval and number of processes of scanner the same way
+// as scan of used filesystems
+func (ps *processScanner) scanDeleted(procPath string) map[string]*deletedOpen {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	if ps.deleted != nil && time.Since(ps.deletedLast) < ps.interval {
+		return ps.deleted
+	}
+	ps.deleted = scanDeletedOpen(procPath, ps.maxProcesses)
+	ps.deletedLast = time.Now()
+	return ps.deleted
+}
+
+// Function to fill space held by deleted but open files of filesystems,
+// only top processes holding the most space are kept
+func fillDeletedOpen(scanner *processScanner, procPath string, dfms []dfMetric, top int) {
+	usage := scanner.scanDeleted(procPath)
+	for i := range dfms {
+		du := &deletedOpen{}
+		if found, ok := usage[dfms[i].MajorMinor]; ok {
+			du.Bytes = found.Bytes
+			du.Processes = found.Processes
+			if len(du.Processes) > top {
+				du.Processes = du.Processes[:top]
+			}
+		}
+		dfms[i].DeletedOpen = du
+	}
+}
+
+// deletedOpenTag returns processes holding deleted files as comma separated
+// list of <pid>:<comm>:<bytes>
+func deletedOpenTag(du *deletedOpen) string {
+	procs := []string{}
+	for _, proc := range du.Processes {
+		procs = append(procs, fmt.Sprintf("%d:%s:%d", proc.PID, proc.Comm, proc.Bytes))
+	}
+	return strings.Join(procs, ",")
+}
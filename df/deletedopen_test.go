@@ -0,0 +1,113 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap/control/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// addOpenFile links descriptor of fake process to file
+func addOpenFile(procPath string, pid string, fd string, target string) {
+	os.MkdirAll(filepath.Join(procPath, pid, "fd"), 0755)
+	os.Symlink(target, filepath.Join(procPath, pid, "fd", fd))
+}
+
+func TestDeletedOpen(t *testing.T) {
+	Convey("Given processes holding deleted files", t, func() {
+		root, _ := ioutil.TempDir("", "df-deleted")
+		defer os.RemoveAll(root)
+		procPath := filepath.Join(root, "proc")
+		// link targets with (deleted) suffix stand for unlinked files
+		logs := filepath.Join(root, "logs")
+		makeTree(logs, map[string]int{
+			"syslog.1 (deleted)": 64 * 1024,
+			"app.log (deleted)":  16 * 1024,
+			"open.log":           32 * 1024,
+		})
+		addOpenFile(procPath, "100", "3", filepath.Join(logs, "syslog.1 (deleted)"))
+		addOpenFile(procPath, "100", "4", filepath.Join(logs, "syslog.1 (deleted)"))
+		addOpenFile(procPath, "100", "5", filepath.Join(logs, "open.log"))
+		ioutil.WriteFile(filepath.Join(procPath, "100", "comm"), []byte("rsyslogd\n"), 0644)
+		addOpenFile(procPath, "200", "7", filepath.Join(logs, "app.log (deleted)"))
+		addOpenFile(procPath, "200", "8", filepath.Join(logs, "syslog.1 (deleted)"))
+		ioutil.WriteFile(filepath.Join(procPath, "200", "comm"), []byte("app\n"), 0644)
+		os.MkdirAll(filepath.Join(procPath, "self"), 0755)
+
+		var st syscall.Stat_t
+		syscall.Stat(logs, &st)
+		majmin := majorMinor(uint64(st.Dev))
+		dfms := []dfMetric{
+			{MountPoint: "logs", MajorMinor: majmin},
+			{MountPoint: "other", MajorMinor: "253:99"},
+		}
+
+		Convey("When space held by deleted files is filled", func() {
+			fillDeletedOpen(newProcessScanner(0, 0), procPath, dfms, 1)
+
+			Convey("Then each deleted file is counted once", func() {
+				So(dfms[0].DeletedOpen.Bytes, ShouldEqual, 80*1024)
+				So(dfms[1].DeletedOpen.Bytes, ShouldEqual, 0)
+				metric := plugin.MetricType{}
+				fillMetric("space_deleted_open", dfms[0], &metric)
+				So(metric.Data(), ShouldEqual, 80)
+			})
+
+			Convey("Then top processes are reported", func() {
+				So(dfms[0].DeletedOpen.Processes, ShouldResemble, []procUsage{
+					{PID: 200, Comm: "app", Bytes: 80 * 1024},
+				})
+				So(createTags(dfms[0])["deleted_open_processes"], ShouldEqual, "200:app:81920")
+				_, ok := createTags(dfms[1])["deleted_open_processes"]
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When all processes are reported", func() {
+			fillDeletedOpen(newProcessScanner(0, 0), procPath, dfms, 5)
+			So(deletedOpenTag(dfms[0].DeletedOpen), ShouldEqual, "200:app:81920,100:rsyslogd:65536")
+		})
+
+		Convey("When processes are scanned within interval", func() {
+			scanner := newProcessScanner(time.Hour, 1)
+			fillDeletedOpen(scanner, procPath, dfms, 5)
+			addOpenFile(procPath, "100", "6", filepath.Join(logs, "app.log (deleted)"))
+			fillDeletedOpen(scanner, procPath, dfms, 5)
+
+			Convey("Then number of processes is limited and previous result is reused", func() {
+				So(deletedOpenTag(dfms[0].DeletedOpen), ShouldEqual, "100:rsyslogd:65536")
+				So(dfms[0].DeletedOpen.Bytes, ShouldEqual, 64*1024)
+			})
+		})
+	})
+
+	Convey("Given device numbers", t, func() {
+		So(majorMinor(0x801), ShouldEqual, "8:1")
+		So(majorMinor(0xfd00), ShouldEqual, "253:0")
+		So(majorMinor(0x100000), ShouldEqual, "0:256")
+	})
+}
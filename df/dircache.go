@@ -0,0 +1,132 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	dfltDirectoryCacheMaxEntries = 1000000
+	// growth of files does not change modification time of their directory,
+	// so cached listings are read again after this age
+	dfltDirectoryCacheMaxAge = 10 * time.Minute
+	// returned by walk which needs more directories than cache can hold
+	errDirCacheFull = errors.New("directory cache is full")
+)
+
+// dirEntry holds usage of single directory listing, it is valid
+// as long as modification time of directory does not change
+// and the entry is not older than maximal age
+type dirEntry struct {
+	mtime time.Time
+	// time when listing was read
+	measured time.Time
+	// usage of entries which are not subdirectories
+	own dirSize
+	// names of subdirectories on the same filesystem
+	subdirs []string
+	// collection which visited the entry
+	gen uint64
+}
+
+// dirCache keeps directory listings between collections, so only
+// directories modified since the previous walk are read again
+type dirCache struct {
+	mutex sync.Mutex
+	// maximal number of cached directories, 0 means no limit
+	maxEntries int
+	// maximal age of cached listing, 0 means no limit
+	maxAge  time.Duration
+	entries map[fileID]*dirEntry
+	// the last complete usage of watched directories
+	results map[string]dirMetric
+	gen     uint64
+}
+
+func newDirCache(maxEntries int, maxAge time.Duration) *dirCache {
+	return &dirCache{
+		maxEntries: maxEntries,
+		maxAge:     maxAge,
+		entries:    map[fileID]*dirEntry{},
+		results:    map[string]dirMetric{},
+	}
+}
+
+// Return identity of file
+func fileIDOf(fi os.FileInfo) fileID {
+	id := fileID{dev: deviceOf(fi)}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		id.ino = uint64(st.Ino)
+	}
+	return id
+}
+
+// lookup returns cached listing of directory if it was not modified since
+// it was cached and it is not too old, entry is marked as visited by current collection
+func (dc *dirCache) lookup(fi os.FileInfo) *dirEntry {
+	entry, ok := dc.entries[fileIDOf(fi)]
+	if !ok || !entry.mtime.Equal(fi.ModTime()) {
+		return nil
+	}
+	if dc.maxAge > 0 && time.Since(entry.measured) >= dc.maxAge {
+		return nil
+	}
+	entry.gen = dc.gen
+	return entry
+}
+
+// store caches listing of directory, false is returned if there is no room for it
+func (dc *dirCache) store(fi os.FileInfo, own dirSize, subdirs []string) bool {
+	id := fileIDOf(fi)
+	if _, ok := dc.entries[id]; !ok && dc.maxEntries > 0 && len(dc.entries) >= dc.maxEntries {
+		return false
+	}
+	dc.entries[id] = &dirEntry{
+		mtime:    fi.ModTime(),
+		measured: time.Now(),
+		own:      own,
+		subdirs:  subdirs,
+		gen:      dc.gen,
+	}
+	return true
+}
+
+// begin starts new collection
+func (dc *dirCache) begin() {
+	dc.gen++
+}
+
+// prune drops directories which were not visited by current collection,
+// it is done also after partial walks, so that removed directories do not
+// hold room in full cache
+func (dc *dirCache) prune() {
+	for id, entry := range dc.entries {
+		if entry.gen != dc.gen {
+			delete(dc.entries, id)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDirCache(t *testing.T) {
+	Convey("Given watched directory and directory cache", t, func() {
+		root, _ := ioutil.TempDir("", "df-dircache")
+		defer os.RemoveAll(root)
+		makeTree(root, map[string]int{
+			"a/1.log":     16 * 1024,
+			"a/b/2.log":   16 * 1024,
+			"a/b/c/3.log": 16 * 1024,
+			"d/4.log":     16 * 1024,
+		})
+		opts := directoryOptions{paths: []string{root}, topChildren: 5}
+		cache := newDirCache(0, 0)
+		uncached := collectDirectories(opts, nil, []string{}, true)
+		dms := collectDirectories(opts, cache, []string{}, true)
+
+		Convey("Then incremental walk reports the same usage", func() {
+			So(dms[0].Size, ShouldResemble, uncached[0].Size)
+			So(dms[0].Children, ShouldResemble, uncached[0].Children)
+			// a, a/b, a/b/c and d, watched directory itself is not cached
+			So(len(cache.entries), ShouldEqual, 4)
+		})
+
+		Convey("When directory is not modified", func() {
+			// growth of file does not change modification time of directory
+			dir := filepath.Join(root, "a", "b")
+			fi, _ := os.Stat(dir)
+			ioutil.WriteFile(filepath.Join(dir, "2.log"), make([]byte, 64*1024), 0644)
+			os.Chtimes(dir, fi.ModTime(), fi.ModTime())
+			dms = collectDirectories(opts, cache, []string{}, true)
+
+			Convey("Then cached usage is reported", func() {
+				So(dms[0].Size, ShouldResemble, uncached[0].Size)
+			})
+		})
+
+		Convey("When directory is modified", func() {
+			makeTree(root, map[string]int{"a/b/5.log": 16 * 1024})
+			os.RemoveAll(filepath.Join(root, "a", "b", "c"))
+			dms = collectDirectories(opts, cache, []string{}, true)
+
+			Convey("Then its listing is read again", func() {
+				walked := collectDirectories(opts, nil, []string{}, true)
+				So(dms[0].Size, ShouldResemble, walked[0].Size)
+				So(dms[0].Size.Files, ShouldEqual, 4)
+				So(dms[0].Size.Inodes, ShouldEqual, 8)
+			})
+
+			Convey("Then removed directories are dropped from cache", func() {
+				So(len(cache.entries), ShouldEqual, 3)
+			})
+		})
+
+		Convey("When cache cannot hold new directories", func() {
+			cache.maxEntries = 4
+			makeTree(root, map[string]int{"e/f/6.log": 16 * 1024})
+			dms = collectDirectories(opts, cache, []string{}, true)
+
+			Convey("Then the last complete usage is reported", func() {
+				So(dms[0].Stale, ShouldBeTrue)
+				So(dms[0].Size, ShouldResemble, uncached[0].Size)
+				So(createDirectoryMetric(dms[0], nil, "dir_bytes", true).Tags()["stale"], ShouldEqual, "true")
+			})
+		})
+	})
+
+	Convey("Given full directory cache", t, func() {
+		root, _ := ioutil.TempDir("", "df-dircache")
+		defer os.RemoveAll(root)
+		makeTree(root, map[string]int{
+			"a/1.log":     16 * 1024,
+			"a/b/c/3.log": 16 * 1024,
+			"d/4.log":     16 * 1024,
+		})
+		opts := directoryOptions{paths: []string{root}, topChildren: 5}
+		cache := newDirCache(4, 0)
+		collectDirectories(opts, cache, []string{}, true)
+		So(len(cache.entries), ShouldEqual, 4)
+
+		Convey("When tree is replaced by one of the same size", func() {
+			os.RemoveAll(filepath.Join(root, "d"))
+			os.RemoveAll(filepath.Join(root, "a", "b", "c"))
+			makeTree(root, map[string]int{"e/f/6.log": 16 * 1024})
+			collectDirectories(opts, cache, []string{}, true)
+			dms := collectDirectories(opts, cache, []string{}, true)
+
+			Convey("Then removed directories are evicted and complete usage is reported", func() {
+				walked := collectDirectories(opts, nil, []string{}, true)
+				So(dms[0].Stale, ShouldBeFalse)
+				So(dms[0].Size.Complete, ShouldBeTrue)
+				So(dms[0].Size, ShouldResemble, walked[0].Size)
+			})
+		})
+	})
+
+	Convey("Given directory cache with maximal age of entries", t, func() {
+		root, _ := ioutil.TempDir("", "df-dircache")
+		defer os.RemoveAll(root)
+		makeTree(root, map[string]int{"log/a/app.log": 16 * 1024})
+		opts := directoryOptions{paths: []string{root}, topChildren: 5}
+		cache := newDirCache(0, time.Hour)
+		collectDirectories(opts, cache, []string{}, true)
+
+		// growth of file does not change modification time of directory
+		dir := filepath.Join(root, "log", "a")
+		fi, _ := os.Stat(dir)
+		ioutil.WriteFile(filepath.Join(dir, "app.log"), make([]byte, 256*1024), 0644)
+		os.Chtimes(dir, fi.ModTime(), fi.ModTime())
+		walked := collectDirectories(opts, nil, []string{}, true)
+
+		Convey("When cached listings are younger than maximal age", func() {
+			dms := collectDirectories(opts, cache, []string{}, true)
+
+			Convey("Then cached usage is reported", func() {
+				So(dms[0].Size.Bytes, ShouldBeLessThan, walked[0].Size.Bytes)
+			})
+		})
+
+		Convey("When cached listings are older than maximal age", func() {
+			for _, entry := range cache.entries {
+				entry.measured = entry.measured.Add(-2 * time.Hour)
+			}
+			dms := collectDirectories(opts, cache, []string{}, true)
+
+			Convey("Then directories are measured again", func() {
+				So(dms[0].Size, ShouldResemble, walked[0].Size)
+			})
+		})
+	})
+
+	Convey("Given directory cache too small for the first walk", t, func() {
+		root, _ := ioutil.TempDir("", "df-dircache")
+		defer os.RemoveAll(root)
+		makeTree(root, map[string]int{"a/b/1.log": 16 * 1024})
+		cache := newDirCache(1, 0)
+		size, _, err := walkDirCached(root, walkLimits{}, cache)
+
+		Convey("Then incomplete usage is returned", func() {
+			So(err, ShouldEqual, errDirCacheFull)
+			So(size.Complete, ShouldBeFalse)
+		})
+	})
+}
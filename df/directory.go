@@ -0,0 +1,261 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/snap/control/plugin"
+	"github.com/intelsdi-x/snap/core"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// namespace element preceding watched directory
+	nsDirectory = "directory"
+	// namespace element preceding the largest children of watched directory
+	nsLargest = "largest"
+)
+
+var (
+	dirMetricsKind = []string{
+		"dir_bytes",
+		"dir_inodes",
+		"dir_files",
+	}
+	dfltDirectoryMaxDepth    = 64
+	dfltDirectoryMaxFiles    = 1000000
+	dfltDirectoryTimeBudget  = 10 * time.Second
+	dfltDirectoryTopChildren = 5
+)
+
+// dirMetric holds usage of watched directory
+type dirMetric struct {
+	Path string
+	// name of directory used in metric namespace
+	Name string
+	Size dirSize
+	// the largest children, sorted by size
+	Children  []childSize
+	Timestamp time.Time
+	// true when the last complete usage is reported because directory cache is full
+	Stale bool
+}
+
+// directoryOptions configures collection of watched directories
+type directoryOptions struct {
+	paths       []string
+	maxDepth    int
+	maxFiles    int
+	timeBudget  time.Duration
+	topChildren int
+}
+
+// childrenBySize sorts children from the largest one
+type childrenBySize []childSize
+
+func (c childrenBySize) Len() int           { return len(c) }
+func (c childrenBySize) Less(i, j int) bool { return c[i].Size.Bytes > c[j].Size.Bytes }
+func (c childrenBySize) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+// parseWatchedDirectories returns absolute paths from list of directories (see parseList)
+func parseWatchedDirectories(value string) ([]string, error) {
+	dirs, err := parseList(WatchedDirectories, value)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, dir := range dirs {
+		if !strings.HasPrefix(dir, "/") {
+			return nil, fmt.Errorf("%s: %q is not an absolute path", WatchedDirectories, dir)
+		}
+		paths = append(paths, dir)
+	}
+	return paths, nil
+}
+
+// collectDirectories walks watched directories within configured budgets,
+// excluded mount points are neither reported nor walked, walks are incremental
+// when directory cache is given
+func collectDirectories(opts directoryOptions, cache *dirCache, excluded_fs_names []string, keep_original_mountpoint bool) []dirMetric {
+	dms := []dirMetric{}
+	if cache != nil {
+		cache.mutex.Lock()
+		defer cache.mutex.Unlock()
+		cache.begin()
+	}
+	for _, dir := range opts.paths {
+		if excludedFSFromList(dir, excluded_fs_names) {
+			log.Debug(fmt.Sprintf("Ignoring watched directory %s", dir))
+			continue
+		}
+		limits := walkLimits{
+			MaxFiles: opts.maxFiles,
+			MaxDepth: opts.maxDepth,
+			Excluded: excluded_fs_names,
+		}
+		if opts.timeBudget > 0 {
+			limits.Deadline = time.Now().Add(opts.timeBudget)
+		}
+		size, children, err := walkDirCached(dir, limits, cache)
+		if err == errDirCacheFull && !size.Complete {
+			if last, ok := cache.results[dir]; ok {
+				log.Debug(fmt.Sprintf("Directory cache is full, reporting the last size of %s", dir))
+				last.Stale = true
+				dms = append(dms, last)
+				continue
+			}
+		} else if err != nil && err != errDirCacheFull {
+			log.Error(fmt.Sprintf("Error getting size of %s: %s", dir, err))
+			continue
+		}
+		if !size.Complete {
+			log.Debug(fmt.Sprintf("Size of %s is incomplete, walk budget exhausted", dir))
+		}
+		sort.Sort(childrenBySize(children))
+		if len(children) > opts.topChildren {
+			children = children[:opts.topChildren]
+		}
+		dm := dirMetric{
+			Path:      dir,
+			Name:      mountPointName(dir, keep_original_mountpoint),
+			Size:      size,
+			Children:  children,
+			Timestamp: time.Now(),
+		}
+		if cache != nil && size.Complete {
+			cache.results[dir] = dm
+		}
+		dms = append(dms, dm)
+	}
+	if cache != nil {
+		cache.prune()
+	}
+	return dms
+}
+
+// Return true if namespace requests metrics of watched directories:
+// /intel/procfs/filesystem/directory/<path>/<metric> or
+// /intel/procfs/filesystem/directory/<path>/largest/<child>/<metric>
+func isDirectoryNamespace(ns core.Namespace) bool {
+	lns := len(ns)
+	return (lns == 6 || lns == 8) && ns[len(namespacePrefix)].Value == nsDirectory
+}
+
+// directoryMetricTypes returns metric types of watched directories
+func directoryMetricTypes() []plugin.MetricType {
+	mts := []plugin.MetricType{}
+	for _, kind := range dirMetricsKind {
+		mts = append(mts, plugin.MetricType{
+			Namespace_: core.NewNamespace(namespacePrefix...).
+				AddStaticElement(nsDirectory).
+				AddDynamicElement("directory_path", "path of watched directory").
+				AddStaticElement(kind),
+			Description_: "watched directory metric: " + kind,
+		})
+		mts = append(mts, plugin.MetricType{
+			Namespace_: core.NewNamespace(namespacePrefix...).
+				AddStaticElement(nsDirectory).
+				AddDynamicElement("directory_path", "path of watched directory").
+				AddStaticElement(nsLargest).
+				AddDynamicElement("child", "name of one of the largest children of watched directory").
+				AddStaticElement(kind),
+			Description_: "largest children of watched directory metric: " + kind,
+		})
+	}
+	return mts
+}
+
+// createDirectoryMetric returns metric of watched directory or of its child
+func createDirectoryMetric(dm dirMetric, child *childSize, kind string, keep_original_mountpoint bool) plugin.MetricType {
+	ns := core.NewNamespace(namespacePrefix...).
+		AddStaticElement(nsDirectory).
+		AddDynamicElement("directory_path", "path of watched directory")
+	ns[len(ns)-1].Value = dm.Name
+	size := dm.Size
+	tags := map[string]string{
+		"directory": dm.Path,
+	}
+	if child != nil {
+		name := child.Name
+		if !keep_original_mountpoint {
+			name = mountPointName("/"+name, false)
+		}
+		ns = ns.AddStaticElement(nsLargest).
+			AddDynamicElement("child", "name of one of the largest children of watched directory")
+		ns[len(ns)-1].Value = name
+		size = child.Size
+		tags["child_path"] = strings.TrimSuffix(dm.Path, "/") + "/" + child.Name
+	}
+	ns = ns.AddStaticElement(kind)
+	tags["complete"] = strconv.FormatBool(size.Complete)
+	if dm.Stale {
+		tags["stale"] = "true"
+	}
+	metric := plugin.MetricType{
+		Timestamp_: dm.Timestamp,
+		Namespace_: ns,
+		Tags_:      tags,
+	}
+	switch kind {
+	case "dir_bytes":
+		metric.Data_ = size.Bytes
+	case "dir_inodes":
+		metric.Data_ = size.Inodes
+	case "dir_files":
+		metric.Data_ = size.Files
+	}
+	return metric
+}
+
+// directoryMetrics returns metrics of watched directories matching namespace
+func directoryMetrics(ns core.Namespace, dms []dirMetric, keep_original_mountpoint bool) []plugin.MetricType {
+	metrics := []plugin.MetricType{}
+	elts := ns.Strings()[len(namespacePrefix)+1:]
+	for _, dm := range dms {
+		if !matchElement(elts[0], dm.Name) {
+			continue
+		}
+		for _, kind := range dirMetricsKind {
+			if len(elts) == 2 {
+				if matchElement(elts[1], kind) {
+					metrics = append(metrics, createDirectoryMetric(dm, nil, kind, keep_original_mountpoint))
+				}
+				continue
+			}
+			if !matchElement(elts[1], nsLargest) || !matchElement(elts[3], kind) {
+				continue
+			}
+			for i := range dm.Children {
+				child := createDirectoryMetric(dm, &dm.Children[i], kind, keep_original_mountpoint)
+				if matchElement(elts[2], child.Namespace()[len(namespacePrefix)+3].Value) {
+					metrics = append(metrics, child)
+				}
+			}
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,138 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/intelsdi-x/snap/core"
+)
+
+// makeTree creates files of given sizes relative to root
+func makeTree(root string, files map[string]int) {
+	for file, size := range files {
+		os.MkdirAll(filepath.Join(root, filepath.Dir(file)), 0755)
+		ioutil.WriteFile(filepath.Join(root, file), make([]byte, size), 0644)
+	}
+}
+
+func TestDirectories(t *testing.T) {
+	Convey("Given watched directory", t, func() {
+		root, _ := ioutil.TempDir("", "df-dir")
+		defer os.RemoveAll(root)
+		makeTree(root, map[string]int{
+			"big/a.log":       64 * 1024,
+			"big/b.log":       64 * 1024,
+			"small/c.log":     4 * 1024,
+			"deep/x/y/z.log":  4 * 1024,
+			"excluded/d.log":  128 * 1024,
+			"spool.data.file": 8 * 1024,
+		})
+		opts := directoryOptions{
+			paths:       []string{root},
+			topChildren: 2,
+		}
+
+		Convey("When directory is walked without limits", func() {
+			dms := collectDirectories(opts, nil, []string{filepath.Join(root, "excluded")}, false)
+
+			Convey("Then usage is reported", func() {
+				So(len(dms), ShouldEqual, 1)
+				dm := dms[0]
+				So(dm.Name, ShouldEqual, strings.Replace(strings.Replace(root[1:], "/", "_", -1), ".", "_", -1))
+				So(dm.Size.Complete, ShouldBeTrue)
+				// root, big, small, deep, x, y and 5 files
+				So(dm.Size.Inodes, ShouldEqual, 11)
+				So(dm.Size.Files, ShouldEqual, 5)
+				So(dm.Size.Bytes, ShouldBeGreaterThanOrEqualTo, 144*1024)
+			})
+
+			Convey("Then the largest children are reported", func() {
+				children := dms[0].Children
+				So(len(children), ShouldEqual, 2)
+				So(children[0].Name, ShouldEqual, "big")
+				So(children[0].Size.Files, ShouldEqual, 2)
+			})
+
+			Convey("Then metrics are selected by namespace", func() {
+				metrics := directoryMetrics(core.NewNamespace("intel", "procfs", "filesystem", "directory", "*", "*"), dms, false)
+				So(len(metrics), ShouldEqual, 3)
+				So(metrics[0].Tags()["directory"], ShouldEqual, root)
+
+				metrics = directoryMetrics(core.NewNamespace("intel", "procfs", "filesystem", "directory", dms[0].Name, "largest", "*", "dir_bytes"), dms, false)
+				So(len(metrics), ShouldEqual, 2)
+				So(metrics[0].Namespace()[6].Value, ShouldEqual, "big")
+				So(metrics[0].Namespace()[6].Name, ShouldEqual, "child")
+				So(metrics[0].Tags()["child_path"], ShouldEqual, filepath.Join(root, "big"))
+
+				metrics = directoryMetrics(core.NewNamespace("intel", "procfs", "filesystem", "directory", "other", "dir_bytes"), dms, false)
+				So(metrics, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When directory walk is limited", func() {
+			opts.maxDepth = 2
+			dms := collectDirectories(opts, nil, []string{}, true)
+
+			Convey("Then incomplete usage is reported", func() {
+				So(dms[0].Name, ShouldEqual, root)
+				So(dms[0].Size.Complete, ShouldBeFalse)
+				for _, child := range dms[0].Children {
+					So(child.Size.Complete, ShouldEqual, child.Name != "deep")
+				}
+			})
+		})
+
+		Convey("When watched directory is excluded", func() {
+			dms := collectDirectories(opts, nil, []string{root}, true)
+			So(dms, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given watched directories configuration", t, func() {
+		paths, err := parseWatchedDirectories("/var/log, /var/spool,")
+		So(err, ShouldBeNil)
+		So(paths, ShouldResemble, []string{"/var/log", "/var/spool"})
+
+		_, err = parseWatchedDirectories("var/log")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, WatchedDirectories)
+
+		paths, err = parseWatchedDirectories(`["/srv/a,b", "/var/log"]`)
+		So(err, ShouldBeNil)
+		So(paths, ShouldResemble, []string{"/srv/a,b", "/var/log"})
+
+		_, err = parseWatchedDirectories(`["/srv", 1]`)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, WatchedDirectories+":")
+	})
+
+	Convey("Given namespaces", t, func() {
+		So(isDirectoryNamespace(core.NewNamespace("intel", "procfs", "filesystem", "directory", "var_log", "dir_bytes")), ShouldBeTrue)
+		So(isDirectoryNamespace(core.NewNamespace("intel", "procfs", "filesystem", "directory", "space_free")), ShouldBeFalse)
+		So(isDirectoryNamespace(core.NewNamespace("intel", "procfs", "filesystem", "rootfs", "space_free")), ShouldBeFalse)
+	})
+}
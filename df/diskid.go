@@ -0,0 +1,182 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// namespace element is a mount point
+	namespaceKeyMountPoint = "mountpoint"
+	// namespace element is a filesystem UUID
+	namespaceKeyUUID = "uuid"
+	// namespace element is a sanitized device (eg. dev_sda1)
+	namespaceKeyDevice = "device"
+	// namespace element is a filesystem ID reported by statfs
+	namespaceKeyFSID = "fsid"
+	// namespace element is a device number (eg. 8_1)
+	namespaceKeyMajMin = "majmin"
+)
+
+// diskIDs holds persistent names of block device
+type diskIDs struct {
+	UUID     string
+	Label    string
+	PartUUID string
+	ID       string
+}
+
+// validateNamespaceKey returns error if value of namespace_key is not valid
+func validateNamespaceKey(key string) error {
+	switch key {
+	case namespaceKeyMountPoint, namespaceKeyDevice, namespaceKeyUUID, namespaceKeyFSID, namespaceKeyMajMin:
+		return nil
+	}
+	return fmt.Errorf("%s: wrong value %q, expected one of %s, %s, %s, %s, %s", NamespaceKey, key,
+		namespaceKeyMountPoint, namespaceKeyDevice, namespaceKeyUUID, namespaceKeyFSID, namespaceKeyMajMin)
+}
+
+// formatFSID returns filesystem ID reported by statfs as hex string,
+// empty string is returned if filesystem does not report its ID
+func formatFSID(fsid [2]int32) string {
+	if fsid[0] == 0 && fsid[1] == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%08x%08x", uint32(fsid[0]), uint32(fsid[1]))
+}
+
+// unescapeUdev decodes \xHH sequences udev uses in /dev/disk/by-* link names
+func unescapeUdev(name string) string {
+	if !strings.Contains(name, `\x`) {
+		return name
+	}
+	out := []byte{}
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+3 < len(name) && name[i+1] == 'x' {
+			if v, err := strconv.ParseUint(name[i+2:i+4], 16, 8); err == nil {
+				out = append(out, byte(v))
+				i += 3
+				continue
+			}
+		}
+		out = append(out, name[i])
+	}
+	return string(out)
+}
+
+// readDiskLinks returns names of links in /dev/disk/<kind> by kernel
+// name of device they point to, names are sorted for stable results
+func readDiskLinks(devPath string, kind string) map[string][]string {
+	links := map[string][]string{}
+	dir := path.Join(devPath, "disk", kind)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return links
+	}
+	for _, f := range files {
+		target, err := os.Readlink(path.Join(dir, f.Name()))
+		if err != nil {
+			continue
+		}
+		name := path.Base(target)
+		links[name] = append(links[name], unescapeUdev(f.Name()))
+	}
+	for _, names := range links {
+		sort.Strings(names)
+	}
+	return links
+}
+
+// readDiskIDs returns persistent names of block devices by kernel name
+func readDiskIDs(devPath string) map[string]*diskIDs {
+	ids := map[string]*diskIDs{}
+	get := func(name string) *diskIDs {
+		if ids[name] == nil {
+			ids[name] = &diskIDs{}
+		}
+		return ids[name]
+	}
+	for name, links := range readDiskLinks(devPath, "by-uuid") {
+		get(name).UUID = links[0]
+	}
+	for name, links := range readDiskLinks(devPath, "by-label") {
+		get(name).Label = links[0]
+	}
+	for name, links := range readDiskLinks(devPath, "by-partuuid") {
+		get(name).PartUUID = links[0]
+	}
+	for name, links := range readDiskLinks(devPath, "by-id") {
+		get(name).ID = links[0]
+	}
+	return ids
+}
+
+// Function to fill persistent names of block devices backing filesystems
+func fillDiskIDs(devPath string, dfms []dfMetric) {
+	var ids map[string]*diskIDs
+	for i := range dfms {
+		name := dfms[i].DeviceKernelName
+		if name == "" && strings.HasPrefix(dfms[i].Filesystem, "/dev/") {
+			name = path.Base(dfms[i].Filesystem)
+		}
+		if name == "" {
+			continue
+		}
+		if ids == nil {
+			ids = readDiskIDs(devPath)
+		}
+		if id, ok := ids[name]; ok {
+			dfms[i].DiskIDs = *id
+		}
+	}
+}
+
+// Function to replace mount point in namespace with selected identity
+// of filesystem, mount point is kept if filesystem has no such identity
+func applyNamespaceKey(dfms []dfMetric, key string) {
+	for i := range dfms {
+		id := ""
+		switch key {
+		case namespaceKeyDevice:
+			if dfms[i].Filesystem != "" {
+				id = mountPointName(dfms[i].Filesystem, false)
+			}
+		case namespaceKeyUUID:
+			id = dfms[i].DiskIDs.UUID
+		case namespaceKeyFSID:
+			id = dfms[i].FSID
+		case namespaceKeyMajMin:
+			id = strings.Replace(dfms[i].MajorMinor, ":", "_", 1)
+		}
+		if id != "" {
+			dfms[i].MountPoint = id
+			dfms[i].KeyedBy = key
+		}
+	}
+}
@@ -0,0 +1,139 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFormatFSID(t *testing.T) {
+	Convey("Given filesystem IDs reported by statfs", t, func() {
+		So(formatFSID([2]int32{0, 0}), ShouldBeEmpty)
+		So(formatFSID([2]int32{-1, 1}), ShouldEqual, "ffffffff00000001")
+	})
+}
+
+func TestDiskIDs(t *testing.T) {
+	Convey("Given /dev/disk with persistent names", t, func() {
+		devPath, _ := ioutil.TempDir("", "df-dev")
+		defer os.RemoveAll(devPath)
+		links := map[string]map[string]string{
+			"by-uuid": {
+				"3f1a7b2c-0000-4000-8000-000000000001": "sdb1",
+				"3f1a7b2c-0000-4000-8000-000000000002": "dm-3",
+			},
+			"by-label":    {`my\x20data`: "sdb1"},
+			"by-partuuid": {"0b1c2d3e-01": "sdb1"},
+			"by-id": {
+				"wwn-0x5002538e40a1b2c3-part1":   "sdb1",
+				"ata-Samsung_SSD_860_S3Z1-part1": "sdb1",
+				"dm-name-vg0-data":               "dm-3",
+			},
+		}
+		for kind, entries := range links {
+			os.MkdirAll(filepath.Join(devPath, "disk", kind), 0755)
+			for name, target := range entries {
+				os.Symlink(filepath.Join("..", "..", target), filepath.Join(devPath, "disk", kind, name))
+			}
+		}
+
+		dfms := []dfMetric{
+			{Filesystem: "/dev/sdb1", MajorMinor: "8:17", FSID: "a1b2c3d400000001", UnchangedMountPoint: "/data", MountPoint: "/data"},
+			{Filesystem: "/dev/mapper/vg0-data", DeviceKernelName: "dm-3", UnchangedMountPoint: "/srv", MountPoint: "/srv"},
+			{Filesystem: "nfs01:/export", UnchangedMountPoint: "/home", MountPoint: "/home"},
+		}
+		fillDiskIDs(devPath, dfms)
+
+		Convey("Then persistent names are resolved", func() {
+			So(dfms[0].DiskIDs, ShouldResemble, diskIDs{
+				UUID:     "3f1a7b2c-0000-4000-8000-000000000001",
+				Label:    "my data",
+				PartUUID: "0b1c2d3e-01",
+				ID:       "ata-Samsung_SSD_860_S3Z1-part1",
+			})
+			So(dfms[1].DiskIDs.UUID, ShouldEqual, "3f1a7b2c-0000-4000-8000-000000000002")
+			So(dfms[1].DiskIDs.Label, ShouldBeEmpty)
+			So(dfms[2].DiskIDs, ShouldResemble, diskIDs{})
+
+			tags := createTags(dfms[0])
+			So(tags["uuid"], ShouldEqual, "3f1a7b2c-0000-4000-8000-000000000001")
+			So(tags["label"], ShouldEqual, "my data")
+			So(tags["partuuid"], ShouldEqual, "0b1c2d3e-01")
+			So(tags, ShouldNotContainKey, "mount_point")
+		})
+
+		Convey("When namespace is keyed by UUID", func() {
+			applyNamespaceKey(dfms, namespaceKeyUUID)
+
+			Convey("Then UUID replaces mount point when available", func() {
+				So(dfms[0].MountPoint, ShouldEqual, "3f1a7b2c-0000-4000-8000-000000000001")
+				So(dfms[2].MountPoint, ShouldEqual, "/home")
+				So(createTags(dfms[0])["mount_point"], ShouldEqual, "/data")
+			})
+		})
+
+		Convey("When namespace is keyed by device", func() {
+			applyNamespaceKey(dfms, namespaceKeyDevice)
+
+			Convey("Then sanitized device replaces mount point", func() {
+				So(dfms[0].MountPoint, ShouldEqual, "dev_sdb1")
+				So(dfms[1].MountPoint, ShouldEqual, "dev_mapper_vg0-data")
+				tags := createTags(dfms[0])
+				So(tags["mount_point"], ShouldEqual, "/data")
+				So(tags["device"], ShouldEqual, "/dev/sdb1")
+			})
+		})
+
+		Convey("When namespace is keyed by filesystem ID", func() {
+			applyNamespaceKey(dfms, namespaceKeyFSID)
+
+			Convey("Then filesystem ID replaces mount point when available", func() {
+				So(dfms[0].MountPoint, ShouldEqual, "a1b2c3d400000001")
+				So(dfms[1].MountPoint, ShouldEqual, "/srv")
+				So(dfms[1].KeyedBy, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When namespace is keyed by device number", func() {
+			applyNamespaceKey(dfms, namespaceKeyMajMin)
+
+			Convey("Then device number replaces mount point and other identities are tags", func() {
+				So(dfms[0].MountPoint, ShouldEqual, "8_17")
+				tags := createTags(dfms[0])
+				So(tags["majmin"], ShouldEqual, "8:17")
+				So(tags["fsid"], ShouldEqual, "a1b2c3d400000001")
+				So(tags["uuid"], ShouldEqual, "3f1a7b2c-0000-4000-8000-000000000001")
+				So(tags["mount_point"], ShouldEqual, "/data")
+			})
+		})
+
+		Convey("Then wrong namespace key is reported", func() {
+			for _, key := range []string{namespaceKeyMountPoint, namespaceKeyDevice, namespaceKeyUUID, namespaceKeyFSID, namespaceKeyMajMin} {
+				So(validateNamespaceKey(key), ShouldBeNil)
+			}
+			So(validateNamespaceKey("label"), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,120 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	// volume of pod: <kubelet root>/pods/<uid>/volumes/<plugin>/<name>
+	kubeletVolumePattern = regexp.MustCompile(`^(?P<root>/.*)/pods/(?P<pod_uid>[0-9a-f]{8}-[0-9a-f-]{27})/volumes/(?P<volume_plugin>[^/]+)/(?P<volume_name>[^/]+)(/|$)`)
+	// subPath of pod volume: <kubelet root>/pods/<uid>/volume-subpaths/<name>/<container>/<index>
+	kubeletSubPathPattern = regexp.MustCompile(`^(?P<root>/.*)/pods/(?P<pod_uid>[0-9a-f]{8}-[0-9a-f-]{27})/volume-subpaths/(?P<volume_name>[^/]+)/`)
+)
+
+// kubernetesAttributor adds pod_uid, volume_plugin and volume_name
+// attributes to volumes mounted by kubelet
+type kubernetesAttributor struct {
+	resolveNames bool
+	readFile     func(string) ([]byte, error)
+}
+
+func newKubernetesAttributor(resolveNames bool) attributor {
+	return &kubernetesAttributor{
+		resolveNames: resolveNames,
+		readFile:     ioutil.ReadFile,
+	}
+}
+
+// header of hosts file generated by kubelet, hosts files of pods using host
+// network are copies of hosts file of node with different header
+const kubeletHostsHeader = "# Kubernetes-managed hosts file."
+
+// podFromHosts returns name and namespace of pod from hosts file
+// generated by kubelet, namespace is known only for pods with subdomain
+// (<hostname>.<subdomain>.<namespace>.svc.<cluster domain>); files without
+// header of kubelet (eg. copies of hosts file of node) are not trusted
+func podFromHosts(content []byte) (string, string) {
+	var name, namespace string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != kubeletHostsHeader {
+		return "", ""
+	}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// host aliases follow the entry of pod itself
+		if strings.HasPrefix(line, "# Entries added by HostAliases") {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[1] == "localhost" || strings.HasPrefix(fields[1], "ip6-") {
+			continue
+		}
+		name, namespace = fields[len(fields)-1], ""
+		for _, host := range fields[1:] {
+			labels := strings.Split(host, ".")
+			if len(labels) >= 4 && labels[3] == "svc" {
+				namespace = labels[2]
+			}
+		}
+	}
+	return name, namespace
+}
+
+func (ka *kubernetesAttributor) attribute(dfm *dfMetric) {
+	groups := matchGroups(kubeletVolumePattern, dfm.UnchangedMountPoint)
+	if groups == nil {
+		groups = matchGroups(kubeletSubPathPattern, dfm.UnchangedMountPoint)
+	}
+	if groups == nil {
+		return
+	}
+	dfm.setAttribute("pod_uid", groups["pod_uid"])
+	dfm.setAttribute("volume_name", groups["volume_name"])
+	if groups["volume_plugin"] != "" {
+		// kubelet escapes slash in plugin name (eg. kubernetes.io~csi)
+		dfm.setAttribute("volume_plugin", strings.Replace(groups["volume_plugin"], "~", "/", -1))
+	}
+	if !ka.resolveNames {
+		return
+	}
+	content, err := ka.readFile(path.Join(groups["root"], "pods", groups["pod_uid"], "etc-hosts"))
+	if err != nil {
+		return
+	}
+	name, namespace := podFromHosts(content)
+	if name != "" {
+		dfm.setAttribute("pod_name", name)
+	}
+	if namespace != "" {
+		dfm.setAttribute("pod_namespace", namespace)
+	}
+}
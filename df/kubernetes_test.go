@@ -0,0 +1,94 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testPodUID = "6f1c0b1e-2d3a-4b5c-8d7e-0123456789ab"
+
+const testEtcHosts = `# Kubernetes-managed hosts file.
+127.0.0.1	localhost
+::1	localhost ip6-localhost ip6-loopback
+fe00::0	ip6-localnet
+fe00::1	ip6-allnodes
+10.244.1.5	web-0.nginx.shop.svc.cluster.local	web-0
+
+# Entries added by HostAliases.
+10.0.0.1	db.example.com
+`
+
+func TestKubernetesAttribution(t *testing.T) {
+	Convey("Given kubernetes attributor", t, func() {
+		ka := newKubernetesAttributor(true).(*kubernetesAttributor)
+		ka.readFile = func(file string) ([]byte, error) {
+			if file == "/var/lib/kubelet/pods/"+testPodUID+"/etc-hosts" {
+				return []byte(testEtcHosts), nil
+			}
+			return nil, errors.New("no such file or directory")
+		}
+
+		Convey("Then pod volumes are attributed", func() {
+			dfm := dfMetric{UnchangedMountPoint: "/var/lib/kubelet/pods/" + testPodUID + "/volumes/kubernetes.io~csi/pvc-123/mount"}
+			ka.attribute(&dfm)
+			So(dfm.Attributes["pod_uid"], ShouldEqual, testPodUID)
+			So(dfm.Attributes["volume_plugin"], ShouldEqual, "kubernetes.io/csi")
+			So(dfm.Attributes["volume_name"], ShouldEqual, "pvc-123")
+			So(dfm.Attributes["pod_name"], ShouldEqual, "web-0")
+			So(dfm.Attributes["pod_namespace"], ShouldEqual, "shop")
+		})
+
+		Convey("Then volume subpaths are attributed", func() {
+			dfm := dfMetric{UnchangedMountPoint: "/var/lib/kubelet/pods/" + testPodUID + "/volume-subpaths/config/nginx/0"}
+			ka.attribute(&dfm)
+			So(dfm.Attributes["volume_name"], ShouldEqual, "config")
+			So(dfm.Attributes, ShouldNotContainKey, "volume_plugin")
+		})
+
+		Convey("Then other mounts are not attributed", func() {
+			dfm := dfMetric{UnchangedMountPoint: "/var/lib/kubelet"}
+			ka.attribute(&dfm)
+			So(dfm.Attributes, ShouldBeNil)
+		})
+	})
+
+	Convey("Given hosts file of pod without subdomain", t, func() {
+		name, namespace := podFromHosts([]byte(kubeletHostsHeader + "\n127.0.0.1\tlocalhost\n10.244.1.7\tapi-7d4b9f-x2k\n"))
+		So(name, ShouldEqual, "api-7d4b9f-x2k")
+		So(namespace, ShouldBeEmpty)
+	})
+
+	Convey("Given hosts file not generated for pod by kubelet", t, func() {
+		Convey("Then copy of hosts file of node is not trusted", func() {
+			name, namespace := podFromHosts([]byte("# Kubernetes-managed hosts file (host network).\n127.0.0.1\tlocalhost\n10.0.0.5\tnode-1\n"))
+			So(name, ShouldBeEmpty)
+			So(namespace, ShouldBeEmpty)
+		})
+
+		Convey("Then file without header is not trusted", func() {
+			name, _ := podFromHosts([]byte("127.0.0.1\tlocalhost\n10.0.0.5\tnode-1\n"))
+			So(name, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,61 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import "fmt"
+
+const (
+	// mount point is the namespace element, kept as is with keep_original_mountpoint
+	metricLayoutLegacy = "legacy"
+	// namespace element is sanitized mount point, filesystem is described by tags
+	metricLayoutTags = "tags"
+)
+
+// validateMetricLayout returns error if value of metric_layout is not valid
+func validateMetricLayout(layout string) error {
+	switch layout {
+	case metricLayoutLegacy, metricLayoutTags:
+		return nil
+	}
+	return fmt.Errorf("%s: wrong value %q, expected one of %s, %s",
+		MetricLayout, layout, metricLayoutLegacy, metricLayoutTags)
+}
+
+// keepMountPoint returns true if original mount point is used in namespace
+func keepMountPoint(layout string, keep_original_mountpoint bool) bool {
+	return keep_original_mountpoint && layout != metricLayoutTags
+}
+
+// Function to add tags identifying filesystem when metrics use tags layout
+func applyMetricLayout(dfms []dfMetric, layout string) {
+	if layout != metricLayoutTags {
+		return
+	}
+	for i := range dfms {
+		dfms[i].setAttribute("mount_point", dfms[i].UnchangedMountPoint)
+		dfms[i].setAttribute("device", dfms[i].Filesystem)
+		dfms[i].setAttribute("fs_type", dfms[i].FsType)
+		if dfms[i].MountID != "" {
+			dfms[i].setAttribute("mount_id", dfms[i].MountID)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetricLayout(t *testing.T) {
+	Convey("Given filesystems", t, func() {
+		dfms := []dfMetric{
+			{MountID: "25", Filesystem: "/dev/sda1", FsType: "ext4", UnchangedMountPoint: "/var/lib/docker", MountPoint: "var_lib_docker"},
+			{Filesystem: "server:/export", FsType: "nfs", UnchangedMountPoint: "/mnt/nfs", MountPoint: "mnt_nfs"},
+		}
+
+		Convey("When tags layout is applied", func() {
+			applyMetricLayout(dfms, metricLayoutTags)
+
+			Convey("Then filesystem is described by tags", func() {
+				tags := createTags(dfms[0])
+				So(tags["mount_point"], ShouldEqual, "/var/lib/docker")
+				So(tags["device"], ShouldEqual, "/dev/sda1")
+				So(tags["fs_type"], ShouldEqual, "ext4")
+				So(tags["mount_id"], ShouldEqual, "25")
+				_, ok := createTags(dfms[1])["mount_id"]
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When legacy layout is applied", func() {
+			applyMetricLayout(dfms, metricLayoutLegacy)
+			So(dfms[0].Attributes, ShouldBeNil)
+		})
+	})
+
+	Convey("Given metric layout configuration", t, func() {
+		So(validateMetricLayout(metricLayoutLegacy), ShouldBeNil)
+		So(validateMetricLayout(metricLayoutTags), ShouldBeNil)
+		So(validateMetricLayout("flat"), ShouldNotBeNil)
+		So(keepMountPoint(metricLayoutLegacy, true), ShouldBeTrue)
+		So(keepMountPoint(metricLayoutTags, true), ShouldBeFalse)
+		So(keepMountPoint(metricLayoutLegacy, false), ShouldBeFalse)
+	})
+}
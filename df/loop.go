@@ -0,0 +1,171 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	// read-only loop images are reported as any other filesystem
+	collapseLoopOff = "off"
+	// read-only loop images of the same package are reported as one filesystem
+	collapseLoopGroup = "group"
+	// read-only loop images are not reported
+	collapseLoopSuppress = "suppress"
+)
+
+// loopInfo describes backing file of loop device
+type loopInfo struct {
+	BackingFile string
+	Offset      uint64
+	Autoclear   bool
+	// package the image belongs to (eg. core18 for core18_1988.snap)
+	Package string
+	// number of images grouped into metric
+	Images int
+}
+
+// validateCollapseLoop returns error if value of collapse_loop_readonly is not valid
+func validateCollapseLoop(mode string) error {
+	switch mode {
+	case collapseLoopOff, collapseLoopGroup, collapseLoopSuppress:
+		return nil
+	}
+	return fmt.Errorf("%s: wrong value %q, expected one of %s, %s, %s",
+		CollapseLoopReadOnly, mode, collapseLoopOff, collapseLoopGroup, collapseLoopSuppress)
+}
+
+// loopPackage returns name of package from image file name by dropping
+// extension and revision suffix (eg. /var/lib/snapd/snaps/core18_1988.snap => core18)
+func loopPackage(backingFile string) string {
+	name := path.Base(strings.TrimSuffix(backingFile, " (deleted)"))
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if idx := strings.LastIndex(name, "_"); idx > 0 {
+		return name[:idx]
+	}
+	return name
+}
+
+// loopGroupMountPoint returns mount point of group of images of package,
+// revision directory is dropped (eg. /snap/core18/1988 => /snap/core18),
+// so that group keeps its name when revisions are refreshed
+func loopGroupMountPoint(dfm dfMetric) string {
+	name := path.Base(strings.TrimSuffix(dfm.Loop.BackingFile, " (deleted)"))
+	name = strings.TrimSuffix(name, path.Ext(name))
+	idx := strings.LastIndex(name, "_")
+	if idx > 0 && path.Base(dfm.UnchangedMountPoint) == name[idx+1:] {
+		return path.Dir(dfm.UnchangedMountPoint)
+	}
+	return dfm.UnchangedMountPoint
+}
+
+// Function to fill loop device attributes of metric from sysfs
+func fillLoopDevice(sysPath string, dfm *dfMetric) {
+	loopPath := path.Join(sysPath, "block", dfm.DeviceKernelName, "loop")
+	backingFile := readSysfsString(path.Join(loopPath, "backing_file"))
+	if backingFile == "" {
+		return
+	}
+	loop := &loopInfo{
+		BackingFile: backingFile,
+		Autoclear:   readSysfsString(path.Join(loopPath, "autoclear")) == "1",
+		Package:     loopPackage(backingFile),
+		Images:      1,
+	}
+	if offset, err := strconv.ParseUint(readSysfsString(path.Join(loopPath, "offset")), 10, 64); err == nil {
+		loop.Offset = offset
+	}
+	dfm.Loop = loop
+}
+
+// Return true if filesystem is read-only image attached through loop device
+func isLoopReadOnlyImage(dfm dfMetric) bool {
+	if dfm.Loop == nil || dfm.FsType != "squashfs" {
+		return false
+	}
+	for _, option := range strings.Split(dfm.MountOptions, ",") {
+		if option == "ro" {
+			return true
+		}
+	}
+	return false
+}
+
+// collapseLoopReadOnly groups or drops read-only loop images according to mode,
+// grouped images are reported under common parent of their mount points
+// without revision directories
+func collapseLoopReadOnly(dfms []dfMetric, mode string, keep_original_mountpoint bool) []dfMetric {
+	if mode == collapseLoopOff || mode == "" {
+		return dfms
+	}
+	result := []dfMetric{}
+	groups := map[string]int{}
+	for _, dfm := range dfms {
+		if !isLoopReadOnlyImage(dfm) {
+			result = append(result, dfm)
+			continue
+		}
+		if mode == collapseLoopSuppress {
+			continue
+		}
+		mountPoint := loopGroupMountPoint(dfm)
+		idx, ok := groups[dfm.Loop.Package]
+		if !ok {
+			loop := *dfm.Loop
+			dfm.Loop = &loop
+			dfm.UnchangedMountPoint = mountPoint
+			dfm.MountPoint = mountPointName(mountPoint, keep_original_mountpoint)
+			groups[loop.Package] = len(result)
+			result = append(result, dfm)
+			continue
+		}
+		group := &result[idx]
+		group.Blocks += dfm.Blocks
+		group.Used += dfm.Used
+		group.Available += dfm.Available
+		group.Inodes += dfm.Inodes
+		group.IUsed += dfm.IUsed
+		group.IFree += dfm.IFree
+		group.Loop.Images++
+		group.Loop.BackingFile = ""
+		group.Loop.Offset = 0
+		group.UnchangedMountPoint = commonParent(group.UnchangedMountPoint, mountPoint)
+		group.MountPoint = mountPointName(group.UnchangedMountPoint, keep_original_mountpoint)
+	}
+	return result
+}
+
+// commonParent returns longest common directory of two paths
+func commonParent(a string, b string) string {
+	for a != b {
+		if len(a) > len(b) {
+			a = path.Dir(a)
+		} else {
+			b = path.Dir(b)
+		}
+	}
+	return a
+}
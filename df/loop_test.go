@@ -0,0 +1,122 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoopDevice(t *testing.T) {
+	Convey("Given sysfs with loop devices", t, func() {
+		sys := newFakeSysfs()
+		defer sys.cleanup()
+		images := map[string]string{
+			"7:0": "/var/lib/snapd/snaps/core18_1988.snap",
+			"7:1": "/var/lib/snapd/snaps/core18_2066.snap",
+			"7:2": "/var/lib/snapd/snaps/lxd_20326.snap",
+			"7:3": "/srv/images/data.img",
+		}
+		for majorMinor, backingFile := range images {
+			name := "loop" + majorMinor[2:]
+			sys.addDevice(majorMinor, "virtual/block/"+name, map[string]string{})
+			loopPath := filepath.Join(sys.root, "block", name, "loop")
+			os.MkdirAll(loopPath, 0755)
+			ioutil.WriteFile(filepath.Join(loopPath, "backing_file"), []byte(backingFile+"\n"), 0644)
+			ioutil.WriteFile(filepath.Join(loopPath, "offset"), []byte("0\n"), 0644)
+			ioutil.WriteFile(filepath.Join(loopPath, "autoclear"), []byte("1\n"), 0644)
+		}
+		dfms := []dfMetric{
+			{MajorMinor: "8:1", UnchangedMountPoint: "/", MountPoint: "/", FsType: "ext4", MountOptions: "rw"},
+			{MajorMinor: "7:0", UnchangedMountPoint: "/snap/core18/1988", MountPoint: "/snap/core18/1988", FsType: "squashfs", MountOptions: "ro,nodev", Blocks: 10, Used: 10},
+			{MajorMinor: "7:1", UnchangedMountPoint: "/snap/core18/2066", MountPoint: "/snap/core18/2066", FsType: "squashfs", MountOptions: "ro,nodev", Blocks: 20, Used: 20},
+			{MajorMinor: "7:2", UnchangedMountPoint: "/snap/lxd/20326", MountPoint: "/snap/lxd/20326", FsType: "squashfs", MountOptions: "ro,nodev", Blocks: 30, Used: 30},
+			{MajorMinor: "7:3", UnchangedMountPoint: "/srv/data", MountPoint: "/srv/data", FsType: "ext4", MountOptions: "rw"},
+		}
+		for i := range dfms {
+			fillBlockDevice(sys.root, &dfms[i])
+		}
+
+		Convey("Then backing files are resolved", func() {
+			So(dfms[0].Loop, ShouldBeNil)
+			So(dfms[1].Loop, ShouldNotBeNil)
+			So(dfms[1].Loop.BackingFile, ShouldEqual, "/var/lib/snapd/snaps/core18_1988.snap")
+			So(dfms[1].Loop.Package, ShouldEqual, "core18")
+			So(dfms[1].Loop.Autoclear, ShouldBeTrue)
+			tags := createTags(dfms[4])
+			So(tags["loop_backing_file"], ShouldEqual, "/srv/images/data.img")
+			So(tags["loop_package"], ShouldEqual, "data")
+		})
+
+		Convey("When read-only images are not collapsed", func() {
+			result := collapseLoopReadOnly(dfms, collapseLoopOff, true)
+			So(len(result), ShouldEqual, 5)
+		})
+
+		Convey("When read-only images are suppressed", func() {
+			result := collapseLoopReadOnly(dfms, collapseLoopSuppress, true)
+			So(len(result), ShouldEqual, 2)
+			So(result[0].UnchangedMountPoint, ShouldEqual, "/")
+			So(result[1].UnchangedMountPoint, ShouldEqual, "/srv/data")
+		})
+
+		Convey("When read-only images are grouped by package", func() {
+			result := collapseLoopReadOnly(dfms, collapseLoopGroup, false)
+			So(len(result), ShouldEqual, 4)
+			So(result[1].MountPoint, ShouldEqual, "snap_core18")
+			So(result[1].Blocks, ShouldEqual, 30)
+			So(result[1].Loop.Images, ShouldEqual, 2)
+			So(dfms[1].Loop.Images, ShouldEqual, 1)
+			// package with single image is named the same way
+			So(result[2].MountPoint, ShouldEqual, "snap_lxd")
+			So(result[2].UnchangedMountPoint, ShouldEqual, "/snap/lxd")
+			tags := createTags(result[1])
+			So(tags["loop_package"], ShouldEqual, "core18")
+			So(tags["loop_images"], ShouldEqual, "2")
+			So(tags, ShouldNotContainKey, "loop_backing_file")
+		})
+
+		Convey("When the only image of package is refreshed", func() {
+			before := collapseLoopReadOnly([]dfMetric{dfms[1]}, collapseLoopGroup, false)
+			after := collapseLoopReadOnly([]dfMetric{dfms[2]}, collapseLoopGroup, false)
+
+			Convey("Then group keeps its name", func() {
+				So(before[0].MountPoint, ShouldEqual, "snap_core18")
+				So(after[0].MountPoint, ShouldEqual, "snap_core18")
+			})
+		})
+
+		Convey("Then image mounted outside of revision directory keeps its mount point", func() {
+			image := dfMetric{UnchangedMountPoint: "/mnt/tools", FsType: "squashfs", MountOptions: "ro",
+				Loop: &loopInfo{BackingFile: "/srv/tools_v2.img", Package: "tools", Images: 1}}
+			result := collapseLoopReadOnly([]dfMetric{image}, collapseLoopGroup, true)
+			So(result[0].UnchangedMountPoint, ShouldEqual, "/mnt/tools")
+		})
+
+		Convey("Then wrong collapse mode is reported", func() {
+			So(validateCollapseLoop(collapseLoopGroup), ShouldBeNil)
+			So(validateCollapseLoop("yes"), ShouldNotBeNil)
+		})
+	})
+}
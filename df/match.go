@@ -0,0 +1,116 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Return true if namespace element matches value; element may be a glob
+// pattern (`*` matches any string, `?` any single character) or a tuple of
+// alternatives separated by `;` (as in Snap tuples) or `|`,
+// eg. (space_free;inodes_*)
+func matchElement(element string, value string) bool {
+	if element == "*" || element == value {
+		return true
+	}
+	for _, alt := range alternatives(element) {
+		if matchGlob(alt, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return true if namespace element selects single value
+func isLiteral(element string) bool {
+	return !isTuple(element) && !strings.ContainsAny(element, "*?")
+}
+
+func isTuple(element string) bool {
+	return len(element) > 2 && element[0] == '(' && element[len(element)-1] == ')'
+}
+
+// alternatives returns alternatives listed in tuple or element itself
+func alternatives(element string) []string {
+	if !isTuple(element) {
+		return []string{element}
+	}
+	return strings.FieldsFunc(element[1:len(element)-1], func(r rune) bool {
+		return r == ';' || r == '|'
+	})
+}
+
+// matchGlob reports whether value matches pattern containing `*` and `?`
+// wildcards; unlike path.Match wildcards match also `/` in mount points
+func matchGlob(pattern string, value string) bool {
+	p, v := 0, 0
+	star, mark := -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, v
+			p++
+		case star >= 0:
+			mark++
+			p, v = star+1, mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchingKinds returns metric kinds selected by namespace element,
+// in order of kinds; alternative not matching any kind is reported as error
+func matchingKinds(element string, kinds []string) ([]string, error) {
+	if element == "*" {
+		return kinds, nil
+	}
+	selected := map[string]bool{}
+	for _, alt := range alternatives(element) {
+		found := false
+		for _, kind := range kinds {
+			if matchGlob(alt, kind) {
+				selected[kind] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Unknown metric %q", alt)
+		}
+	}
+	matched := []string{}
+	for _, kind := range kinds {
+		if selected[kind] {
+			matched = append(matched, kind)
+		}
+	}
+	return matched, nil
+}
@@ -0,0 +1,66 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMatchElement(t *testing.T) {
+	Convey("Given namespace elements", t, func() {
+		So(matchElement("*", "data"), ShouldBeTrue)
+		So(matchElement("data", "data"), ShouldBeTrue)
+		So(matchElement("data*", "data_backup"), ShouldBeTrue)
+		So(matchElement("data*", "srv"), ShouldBeFalse)
+		So(matchElement("d?ta", "data"), ShouldBeTrue)
+		So(matchElement("/mnt/*", "/mnt/disk/1"), ShouldBeTrue)
+		So(matchElement("(space_free|inodes_*)", "inodes_used"), ShouldBeTrue)
+		So(matchElement("(space_free|inodes_*)", "space_used"), ShouldBeFalse)
+		So(matchElement("(space_free;inodes_free)", "inodes_free"), ShouldBeTrue)
+		So(matchElement("(space_free;inodes_free)", "space_used"), ShouldBeFalse)
+		So(matchElement("*_percent_*", "space_percent_used"), ShouldBeTrue)
+	})
+
+	Convey("Given metric kinds", t, func() {
+		kinds := []string{"space_free", "space_used", "inodes_free"}
+
+		Convey("Then kinds are selected in their order", func() {
+			matched, err := matchingKinds("(inodes_free|space_*)", kinds)
+			So(err, ShouldBeNil)
+			So(matched, ShouldResemble, kinds)
+			matched, err = matchingKinds("*_free", kinds)
+			So(err, ShouldBeNil)
+			So(matched, ShouldResemble, []string{"space_free", "inodes_free"})
+			matched, err = matchingKinds("(space_free;inodes_free)", kinds)
+			So(err, ShouldBeNil)
+			So(matched, ShouldResemble, []string{"space_free", "inodes_free"})
+		})
+
+		Convey("Then unknown kind is reported", func() {
+			_, err := matchingKinds("(space_free|space_avail)", kinds)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "space_avail")
+			_, err = matchingKinds("md_*", kinds)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,212 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/intelsdi-x/snap/control/plugin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	MdStatFile = "mdstat"
+)
+
+// mdInfo describes health of md RAID array
+type mdInfo struct {
+	Name                  string
+	Level                 string
+	Active, Failed, Spare uint64
+	// number of missing devices
+	Degraded uint64
+	// idle, resync, recover, check, repair or reshape
+	SyncAction string
+	// progress of sync action, 100 when array is idle
+	SyncPercent float64
+	// sync speed in KB/s
+	SyncSpeed uint64
+}
+
+// parseMdStat parses content of /proc/mdstat and returns arrays by name
+func parseMdStat(procPath string) (map[string]*mdInfo, error) {
+	fh, err := os.Open(path.Join(procPath, MdStatFile))
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	arrays := map[string]*mdInfo{}
+	var md *mdInfo
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			md = nil
+			continue
+		}
+		// md0 : active raid1 sdb1[1] sda1[0](F)
+		if len(fields) >= 3 && fields[1] == ":" && strings.HasPrefix(fields[0], "md") {
+			md = &mdInfo{Name: fields[0], SyncAction: "idle", SyncPercent: 100}
+			arrays[md.Name] = md
+			for _, field := range fields[3:] {
+				switch {
+				case strings.HasPrefix(field, "("):
+					// (read-only), (auto-read-only)
+				case !strings.Contains(field, "["):
+					md.Level = field
+				case strings.HasSuffix(field, "(F)"):
+					md.Failed++
+				case strings.HasSuffix(field, "(S)"):
+					md.Spare++
+				default:
+					md.Active++
+				}
+			}
+			continue
+		}
+		if md == nil {
+			continue
+		}
+		// 1046528 blocks super 1.2 [2/1] [U_]
+		for _, field := range fields {
+			if !strings.HasPrefix(field, "[") || !strings.Contains(field, "/") {
+				continue
+			}
+			counts := strings.Split(strings.Trim(field, "[]"), "/")
+			total, err1 := strconv.ParseUint(counts[0], 10, 64)
+			working, err2 := strconv.ParseUint(counts[1], 10, 64)
+			if err1 == nil && err2 == nil && total > working {
+				md.Degraded = total - working
+			}
+		}
+		// [==>..]  recovery = 12.6% (132096/1046528) finish=1.2min speed=12345K/sec
+		for i, field := range fields {
+			if field != "=" || i == 0 || i+1 >= len(fields) {
+				continue
+			}
+			percent, err := strconv.ParseFloat(strings.TrimSuffix(fields[i+1], "%"), 64)
+			if err != nil {
+				continue
+			}
+			md.SyncAction = fields[i-1]
+			md.SyncPercent = percent
+		}
+		for _, field := range fields {
+			if strings.HasPrefix(field, "speed=") {
+				speed := strings.TrimSuffix(strings.TrimPrefix(field, "speed="), "K/sec")
+				if v, err := strconv.ParseUint(speed, 10, 64); err == nil {
+					md.SyncSpeed = v
+				}
+			}
+		}
+	}
+	return arrays, scanner.Err()
+}
+
+// Function to fill md RAID attributes with values available in sysfs,
+// which take precedence over values parsed from /proc/mdstat
+func fillMdSysfs(sysPath string, md *mdInfo) {
+	mdPath := path.Join(sysPath, "block", md.Name, "md")
+	if level := readSysfsString(path.Join(mdPath, "level")); level != "" {
+		md.Level = level
+	}
+	if degraded, err := strconv.ParseUint(readSysfsString(path.Join(mdPath, "degraded")), 10, 64); err == nil {
+		md.Degraded = degraded
+	}
+	if action := readSysfsString(path.Join(mdPath, "sync_action")); action != "" {
+		md.SyncAction = action
+	}
+	if md.SyncAction == "idle" {
+		md.SyncPercent = 100
+		md.SyncSpeed = 0
+		return
+	}
+	// sync_completed is "<done> / <total>" in sectors or "none"
+	completed := strings.Split(readSysfsString(path.Join(mdPath, "sync_completed")), "/")
+	if len(completed) == 2 {
+		done, err1 := strconv.ParseUint(strings.TrimSpace(completed[0]), 10, 64)
+		total, err2 := strconv.ParseUint(strings.TrimSpace(completed[1]), 10, 64)
+		if err1 == nil && err2 == nil && total > 0 {
+			md.SyncPercent = float64(done) * 100.0 / float64(total)
+		}
+	}
+	if speed, err := strconv.ParseUint(readSysfsString(path.Join(mdPath, "sync_speed")), 10, 64); err == nil {
+		md.SyncSpeed = speed
+	}
+}
+
+// Function to fill md RAID health of filesystems placed on md arrays
+func fillMdRaid(procPath string, sysPath string, dfms []dfMetric) {
+	var arrays map[string]*mdInfo
+	for i := range dfms {
+		name := dfms[i].DeviceKernelName
+		// partitioned arrays (eg. md0p1)
+		if parent := parentDevice(sysPath, name); parent != "" {
+			name = parent
+		}
+		if !strings.HasPrefix(name, "md") {
+			continue
+		}
+		if arrays == nil {
+			var err error
+			arrays, err = parseMdStat(procPath)
+			if err != nil {
+				log.Error(fmt.Sprintf("Error getting md RAID status: %s", err))
+				return
+			}
+		}
+		md, ok := arrays[name]
+		if !ok {
+			continue
+		}
+		fillMdSysfs(sysPath, md)
+		dfms[i].MdRaid = md
+	}
+}
+
+// Function to fill metric with md RAID health
+func fillMdMetric(kind string, md *mdInfo, metric *plugin.MetricType) {
+	switch kind {
+	case "md_level":
+		metric.Data_ = md.Level
+	case "md_devices_active":
+		metric.Data_ = md.Active
+	case "md_devices_failed":
+		metric.Data_ = md.Failed
+	case "md_devices_spare":
+		metric.Data_ = md.Spare
+	case "md_degraded":
+		metric.Data_ = md.Degraded
+	case "md_sync_action":
+		metric.Data_ = md.SyncAction
+	case "md_sync_percent":
+		metric.Data_ = md.SyncPercent
+	case "md_sync_speed":
+		metric.Data_ = md.SyncSpeed
+	}
+}
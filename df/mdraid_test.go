@@ -0,0 +1,116 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/intelsdi-x/snap/control/plugin"
+)
+
+const testMdStat = `Personalities : [raid1] [raid6] [raid5] [raid4]
+md1 : active raid5 sdd1[3] sdc1[1] sdb1[0] sde1[4](S)
+      2093056 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [UU_]
+      [==>..................]  recovery = 12.6% (132096/1046528) finish=1.2min speed=12345K/sec
+
+md0 : active raid1 sdb2[1] sda2[0](F)
+      1046528 blocks super 1.2 [2/1] [U_]
+
+unused devices: <none>
+`
+
+func TestMdRaid(t *testing.T) {
+	Convey("Given /proc/mdstat with degraded arrays", t, func() {
+		procPath, _ := ioutil.TempDir("", "df-proc")
+		defer os.RemoveAll(procPath)
+		ioutil.WriteFile(filepath.Join(procPath, MdStatFile), []byte(testMdStat), 0644)
+
+		arrays, err := parseMdStat(procPath)
+
+		Convey("Then arrays are parsed", func() {
+			So(err, ShouldBeNil)
+			So(len(arrays), ShouldEqual, 2)
+
+			md := arrays["md1"]
+			So(md.Level, ShouldEqual, "raid5")
+			So(md.Active, ShouldEqual, 3)
+			So(md.Spare, ShouldEqual, 1)
+			So(md.Failed, ShouldEqual, 0)
+			So(md.Degraded, ShouldEqual, 1)
+			So(md.SyncAction, ShouldEqual, "recovery")
+			So(md.SyncPercent, ShouldEqual, 12.6)
+			So(md.SyncSpeed, ShouldEqual, 12345)
+
+			md = arrays["md0"]
+			So(md.Level, ShouldEqual, "raid1")
+			So(md.Active, ShouldEqual, 1)
+			So(md.Failed, ShouldEqual, 1)
+			So(md.Degraded, ShouldEqual, 1)
+			So(md.SyncAction, ShouldEqual, "idle")
+			So(md.SyncPercent, ShouldEqual, 100)
+		})
+
+		Convey("When filesystems are placed on md arrays", func() {
+			sys := newFakeSysfs()
+			defer sys.cleanup()
+			sys.addDevice("9:1", "virtual/block/md1", map[string]string{})
+			sys.addDevice("8:1", "pci0000:00/block/sda/sda1", map[string]string{})
+			mdPath := filepath.Join(sys.root, "block", "md1", "md")
+			os.MkdirAll(mdPath, 0755)
+			ioutil.WriteFile(filepath.Join(mdPath, "sync_action"), []byte("recover\n"), 0644)
+			ioutil.WriteFile(filepath.Join(mdPath, "sync_completed"), []byte("250 / 1000\n"), 0644)
+			ioutil.WriteFile(filepath.Join(mdPath, "sync_speed"), []byte("20000\n"), 0644)
+
+			dfms := []dfMetric{
+				{MajorMinor: "9:1", MountPoint: "/data"},
+				{MajorMinor: "8:1", MountPoint: "/"},
+			}
+			for i := range dfms {
+				fillBlockDevice(sys.root, &dfms[i])
+			}
+			fillMdRaid(procPath, sys.root, dfms)
+
+			Convey("Then md health is attached to filesystem on array", func() {
+				So(dfms[0].MdRaid, ShouldNotBeNil)
+				So(dfms[0].MdRaid.SyncAction, ShouldEqual, "recover")
+				So(dfms[0].MdRaid.SyncPercent, ShouldEqual, 25)
+				So(dfms[0].MdRaid.SyncSpeed, ShouldEqual, 20000)
+				So(dfms[1].MdRaid, ShouldBeNil)
+			})
+
+			Convey("Then md metrics are available only for filesystem on array", func() {
+				So(hasMetric("md_degraded", dfms[0]), ShouldBeTrue)
+				So(hasMetric("md_degraded", dfms[1]), ShouldBeFalse)
+				So(hasMetric("space_free", dfms[1]), ShouldBeTrue)
+
+				metric := plugin.MetricType{}
+				fillMetric("md_degraded", dfms[0], &metric)
+				So(metric.Data(), ShouldEqual, 1)
+				fillMetric("md_level", dfms[0], &metric)
+				So(metric.Data(), ShouldEqual, "raid5")
+			})
+		})
+	})
+}
@@ -0,0 +1,128 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// limit of sets of mount points sharing name remembered as already warned about
+const maxWarnedSharedNames = 1000
+
+var (
+	// sets of mount points sharing name which were already warned about,
+	// collisions usually persist, so they are logged as warning only once
+	warnedSharedNames      = map[string]bool{}
+	warnedSharedNamesMutex sync.Mutex
+)
+
+// nameSuffix returns hash of mount point used to tell apart filesystems sharing name
+func nameSuffix(s string) string {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// Return true if mount point contains characters replaced by sanitization
+func hasSanitizedChars(mountPoint string) bool {
+	return strings.ContainsAny(strings.TrimPrefix(mountPoint, "/"), "_.")
+}
+
+// sharedName orders filesystems sharing name, the first one keeps the name
+type sharedName struct {
+	dfms []dfMetric
+	idxs []int
+}
+
+func (s sharedName) Len() int { return len(s.idxs) }
+func (s sharedName) Less(i, j int) bool {
+	a, b := s.dfms[s.idxs[i]], s.dfms[s.idxs[j]]
+	// mount point without underscores and dots keeps its name (/data/a/b => data_a_b)
+	if hasSanitizedChars(a.UnchangedMountPoint) != hasSanitizedChars(b.UnchangedMountPoint) {
+		return !hasSanitizedChars(a.UnchangedMountPoint)
+	}
+	if a.UnchangedMountPoint != b.UnchangedMountPoint {
+		return a.UnchangedMountPoint < b.UnchangedMountPoint
+	}
+	return a.MountID < b.MountID
+}
+func (s sharedName) Swap(i, j int) { s.idxs[i], s.idxs[j] = s.idxs[j], s.idxs[i] }
+
+// Function to make names of filesystems unique, sanitized mount points
+// like /data/a_b, /data/a/b and /data/a.b share name data_a_b, so all but one
+// of them get suffix with hash of original mount point (eg. data_a_b_9f1c3e2a)
+func disambiguateNames(dfms []dfMetric) {
+	groups := map[string][]int{}
+	names := []string{}
+	for i := range dfms {
+		name := dfms[i].MountPoint
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], i)
+	}
+	for _, name := range names {
+		idxs := groups[name]
+		if len(idxs) < 2 {
+			continue
+		}
+		sort.Sort(sharedName{dfms, idxs})
+		seen := map[string]bool{dfms[idxs[0]].UnchangedMountPoint: true}
+		paths := []string{dfms[idxs[0]].UnchangedMountPoint}
+		for _, i := range idxs[1:] {
+			key := dfms[i].UnchangedMountPoint
+			// the same mount point mounted more than once
+			if seen[key] {
+				key += "\x00" + dfms[i].MountID
+			}
+			seen[key] = true
+			paths = append(paths, dfms[i].UnchangedMountPoint)
+			dfms[i].MountPoint = name + "_" + nameSuffix(key)
+		}
+		warnSharedName(name, paths)
+	}
+}
+
+// Function to log mount points sharing name, the same set of mount points
+// is logged as warning only once and on debug level afterwards
+func warnSharedName(name string, paths []string) {
+	msg := fmt.Sprintf("Mount points %s share name %s, hash suffix is added to all but the first one",
+		strings.Join(paths, ", "), name)
+	key := strings.Join(paths, "\x00")
+	warnedSharedNamesMutex.Lock()
+	defer warnedSharedNamesMutex.Unlock()
+	if warnedSharedNames[key] {
+		log.Debug(msg)
+		return
+	}
+	if len(warnedSharedNames) >= maxWarnedSharedNames {
+		warnedSharedNames = map[string]bool{}
+	}
+	warnedSharedNames[key] = true
+	log.Warn(msg)
+}
@@ -0,0 +1,96 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDisambiguateNames(t *testing.T) {
+	Convey("Given mount points sharing sanitized name", t, func() {
+		dfms := []dfMetric{}
+		for _, mp := range []string{"/data/a_b", "/data/a.b", "/data/a/b", "/var/log"} {
+			dfms = append(dfms, dfMetric{UnchangedMountPoint: mp, MountPoint: mountPointName(mp, false)})
+		}
+		disambiguateNames(dfms)
+
+		Convey("Then mount point without sanitized characters keeps its name", func() {
+			So(dfms[2].MountPoint, ShouldEqual, "data_a_b")
+			So(dfms[3].MountPoint, ShouldEqual, "var_log")
+		})
+
+		Convey("Then other mount points get stable hash suffix", func() {
+			So(dfms[0].MountPoint, ShouldEqual, "data_a_b_"+nameSuffix("/data/a_b"))
+			So(dfms[1].MountPoint, ShouldEqual, "data_a_b_"+nameSuffix("/data/a.b"))
+			So(dfms[0].MountPoint, ShouldNotEqual, dfms[1].MountPoint)
+		})
+
+		Convey("Then original mount point is tagged", func() {
+			So(createTags(dfms[0])["mount_point_original"], ShouldEqual, "/data/a_b")
+		})
+
+		Convey("Then names do not depend on order of mounts", func() {
+			reversed := []dfMetric{dfms[3], dfms[2], dfms[1], dfms[0]}
+			for i := range reversed {
+				reversed[i].MountPoint = mountPointName(reversed[i].UnchangedMountPoint, false)
+			}
+			disambiguateNames(reversed)
+			So(reversed[0].MountPoint, ShouldEqual, dfms[3].MountPoint)
+			So(reversed[1].MountPoint, ShouldEqual, dfms[2].MountPoint)
+			So(reversed[2].MountPoint, ShouldEqual, dfms[1].MountPoint)
+			So(reversed[3].MountPoint, ShouldEqual, dfms[0].MountPoint)
+		})
+	})
+
+	Convey("Given mount point mounted twice", t, func() {
+		dfms := []dfMetric{
+			{MountID: "30", UnchangedMountPoint: "/mnt", MountPoint: "/mnt"},
+			{MountID: "31", UnchangedMountPoint: "/mnt", MountPoint: "/mnt"},
+		}
+		disambiguateNames(dfms)
+		So(dfms[0].MountPoint, ShouldEqual, "/mnt")
+		So(dfms[1].MountPoint, ShouldEqual, "/mnt_"+nameSuffix("/mnt\x0031"))
+	})
+	Convey("Given collision of names persisting between collections", t, func() {
+		var out bytes.Buffer
+		log.SetOutput(&out)
+		defer log.SetOutput(os.Stderr)
+		level := log.GetLevel()
+		log.SetLevel(log.DebugLevel)
+		defer log.SetLevel(level)
+		for i := 0; i < 3; i++ {
+			disambiguateNames([]dfMetric{
+				{UnchangedMountPoint: "/srv/a.b", MountPoint: "srv_a_b"},
+				{UnchangedMountPoint: "/srv/a/b", MountPoint: "srv_a_b"},
+			})
+		}
+
+		Convey("Then it is warned about only once", func() {
+			So(strings.Count(out.String(), "level=warning"), ShouldEqual, 1)
+			So(strings.Count(out.String(), "level=debug"), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,219 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/snap/control/plugin"
+	log "github.com/sirupsen/logrus"
+)
+
+// overlayInfo describes layers of overlay filesystem
+type overlayInfo struct {
+	LowerDirs []string
+	UpperDir  string
+	WorkDir   string
+	// mount point of filesystem holding upperdir
+	UpperFS string
+	// usage of upperdir, set only when upperdir walk is enabled
+	UpperSize *dirSize
+}
+
+// splitOptions splits comma separated mount options,
+// commas escaped with backslash are kept in values
+func splitOptions(options string) []string {
+	result := []string{}
+	current := ""
+	for i := 0; i < len(options); i++ {
+		switch {
+		case options[i] == '\\' && i+1 < len(options) && options[i+1] == ',':
+			current += ","
+			i++
+		case options[i] == ',':
+			result = append(result, current)
+			current = ""
+		default:
+			current += string(options[i])
+		}
+	}
+	return append(result, current)
+}
+
+// parseOverlayOptions returns layers of overlay filesystem from its super options
+func parseOverlayOptions(superOptions string) *overlayInfo {
+	overlay := &overlayInfo{}
+	for _, option := range splitOptions(superOptions) {
+		switch {
+		case strings.HasPrefix(option, "lowerdir="):
+			// lower layers are separated with colons, "::" is used for data-only layers
+			for _, dir := range strings.Split(strings.TrimPrefix(option, "lowerdir="), ":") {
+				if dir != "" {
+					overlay.LowerDirs = append(overlay.LowerDirs, dir)
+				}
+			}
+		case strings.HasPrefix(option, "upperdir="):
+			overlay.UpperDir = strings.TrimPrefix(option, "upperdir=")
+		case strings.HasPrefix(option, "workdir="):
+			overlay.WorkDir = strings.TrimPrefix(option, "workdir=")
+		}
+	}
+	return overlay
+}
+
+// Return true if file is under mount point
+func mountContains(mountPoint string, file string) bool {
+	return file == mountPoint || strings.HasPrefix(file, strings.TrimSuffix(mountPoint, "/")+"/")
+}
+
+// containingMount returns index of filesystem with the longest
+// mount point containing given path, -1 is returned if none is found
+func containingMount(dfms []dfMetric, file string) int {
+	found, foundLen := -1, -1
+	for i, dfm := range dfms {
+		mp := dfm.UnchangedMountPoint
+		if dfm.FsType == "overlay" || !mountContains(mp, file) {
+			continue
+		}
+		if len(mp) > foundLen {
+			found, foundLen = i, len(mp)
+		}
+	}
+	return found
+}
+
+// resolveOverlay returns layers of overlay filesystem, filesystem holding
+// upperdir is looked up among all mounts read from mountinfo, as it does
+// not have to be collected when only some mounts are requested
+func resolveOverlay(superOptions string, mounts []mountEntry) *overlayInfo {
+	overlay := parseOverlayOptions(superOptions)
+	if overlay.UpperDir == "" {
+		return overlay
+	}
+	for _, m := range mounts {
+		mp := m.left[4]
+		if m.right[0] == "overlay" || !mountContains(mp, overlay.UpperDir) {
+			continue
+		}
+		if len(mp) > len(overlay.UpperFS) {
+			overlay.UpperFS = mp
+		}
+	}
+	return overlay
+}
+
+// measuredSize holds usage of upperdir with time of its walk
+type measuredSize struct {
+	size     dirSize
+	measured time.Time
+}
+
+// overlayWalker walks writable layers of overlay filesystems, sizes are reused
+// until interval elapses and each walk is bounded by number of files and time budget
+type overlayWalker struct {
+	mutex      sync.Mutex
+	interval   time.Duration
+	maxFiles   int
+	timeBudget time.Duration
+	sizes      map[string]measuredSize
+}
+
+func newOverlayWalker(interval time.Duration, maxFiles int, timeBudget time.Duration) *overlayWalker {
+	return &overlayWalker{
+		interval:   interval,
+		maxFiles:   maxFiles,
+		timeBudget: timeBudget,
+		sizes:      map[string]measuredSize{},
+	}
+}
+
+// size returns usage of upperdir, previous result is returned
+// if walk interval has not elapsed
+func (ow *overlayWalker) size(upperDir string) (*dirSize, error) {
+	ow.mutex.Lock()
+	defer ow.mutex.Unlock()
+	now := time.Now()
+	if found, ok := ow.sizes[upperDir]; ok && now.Sub(found.measured) < ow.interval {
+		size := found.size
+		return &size, nil
+	}
+	// Forget layers which were not requested within interval (eg. removed containers)
+	for dir, found := range ow.sizes {
+		if now.Sub(found.measured) >= ow.interval {
+			delete(ow.sizes, dir)
+		}
+	}
+	limits := walkLimits{MaxFiles: ow.maxFiles}
+	if ow.timeBudget > 0 {
+		limits.Deadline = now.Add(ow.timeBudget)
+	}
+	size, err := walkDirSize(upperDir, limits)
+	if err != nil {
+		return nil, err
+	}
+	if !size.Complete {
+		log.Debug(fmt.Sprintf("Size of %s is incomplete, limit of %d files or %s reached", upperDir, ow.maxFiles, ow.timeBudget))
+	}
+	ow.sizes[upperDir] = measuredSize{size: size, measured: now}
+	return &size, nil
+}
+
+// Function to fill layers of overlay filesystems, usage of their
+// writable layers is filled only if walker is given
+func fillOverlay(dfms []dfMetric, walker *overlayWalker) {
+	for i := range dfms {
+		if dfms[i].FsType != "overlay" {
+			continue
+		}
+		// Layers are resolved when mountinfo is read, otherwise
+		// upperdir is looked up among given filesystems
+		overlay := dfms[i].Overlay
+		if overlay == nil {
+			overlay = parseOverlayOptions(dfms[i].SuperOptions)
+			if idx := containingMount(dfms, overlay.UpperDir); overlay.UpperDir != "" && idx >= 0 {
+				overlay.UpperFS = dfms[idx].UnchangedMountPoint
+			}
+		}
+		if walker != nil && overlay.UpperDir != "" {
+			size, err := walker.size(overlay.UpperDir)
+			if err != nil {
+				log.Error(fmt.Sprintf("Error getting size of %s: %s", overlay.UpperDir, err))
+			} else {
+				overlay.UpperSize = size
+			}
+		}
+		dfms[i].Overlay = overlay
+	}
+}
+
+// Function to fill metric with usage of overlay writable layer
+func fillOverlayMetric(kind string, overlay *overlayInfo, metric *plugin.MetricType) {
+	switch kind {
+	case "overlay_upper_bytes":
+		metric.Data_ = overlay.UpperSize.Bytes
+	case "overlay_upper_inodes":
+		metric.Data_ = overlay.UpperSize.Inodes
+	}
+}
@@ -0,0 +1,189 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/intelsdi-x/snap/control/plugin"
+)
+
+func TestOverlay(t *testing.T) {
+	Convey("Given overlay super options", t, func() {
+		overlay := parseOverlayOptions(`rw,lowerdir=/var/lib/docker/overlay2/l/A:/var/lib/docker/overlay2/l/B,upperdir=/var/lib/docker/overlay2/abc/diff,workdir=/var/lib/docker/overlay2/abc/work,xino=off`)
+
+		Convey("Then layers are parsed", func() {
+			So(overlay.LowerDirs, ShouldResemble, []string{"/var/lib/docker/overlay2/l/A", "/var/lib/docker/overlay2/l/B"})
+			So(overlay.UpperDir, ShouldEqual, "/var/lib/docker/overlay2/abc/diff")
+			So(overlay.WorkDir, ShouldEqual, "/var/lib/docker/overlay2/abc/work")
+		})
+
+		Convey("Then escaped commas are kept", func() {
+			So(splitOptions(`rw,upperdir=/a\,b,workdir=/w`), ShouldResemble, []string{"rw", "upperdir=/a,b", "workdir=/w"})
+		})
+	})
+
+	Convey("Given overlay filesystem with upperdir", t, func() {
+		upper, _ := ioutil.TempDir("", "df-upper")
+		defer os.RemoveAll(upper)
+		os.MkdirAll(filepath.Join(upper, "etc", "nginx"), 0755)
+		ioutil.WriteFile(filepath.Join(upper, "etc", "nginx", "nginx.conf"), make([]byte, 10000), 0644)
+		ioutil.WriteFile(filepath.Join(upper, "etc", "hosts"), []byte("127.0.0.1 localhost\n"), 0644)
+		os.Link(filepath.Join(upper, "etc", "hosts"), filepath.Join(upper, "hosts"))
+
+		dfms := []dfMetric{
+			{UnchangedMountPoint: "/", FsType: "ext4"},
+			{UnchangedMountPoint: filepath.Dir(upper), FsType: "xfs"},
+			{UnchangedMountPoint: "/var/lib/docker/overlay2/abc/merged", FsType: "overlay",
+				SuperOptions: "rw,lowerdir=/l1,upperdir=" + upper + ",workdir=/w"},
+		}
+
+		Convey("When upperdir walk is disabled", func() {
+			fillOverlay(dfms, nil)
+
+			Convey("Then backing filesystem of upperdir is reported", func() {
+				So(dfms[0].Overlay, ShouldBeNil)
+				So(dfms[2].Overlay.UpperFS, ShouldEqual, filepath.Dir(upper))
+				So(dfms[2].Overlay.UpperSize, ShouldBeNil)
+				So(hasMetric("overlay_upper_bytes", dfms[2]), ShouldBeFalse)
+				tags := createTags(dfms[2])
+				So(tags["overlay_upper_dir"], ShouldEqual, upper)
+				So(tags["overlay_lower_layers"], ShouldEqual, "1")
+			})
+		})
+
+		Convey("When upperdir walk is enabled", func() {
+			fillOverlay(dfms, newOverlayWalker(0, 0, 0))
+
+			Convey("Then size of upperdir is reported", func() {
+				size := dfms[2].Overlay.UpperSize
+				So(size, ShouldNotBeNil)
+				So(size.Complete, ShouldBeTrue)
+				// upper, etc, nginx, nginx.conf and hosts linked twice
+				So(size.Inodes, ShouldEqual, 5)
+				So(size.Bytes, ShouldBeGreaterThanOrEqualTo, 10000)
+				So(hasMetric("overlay_upper_bytes", dfms[2]), ShouldBeTrue)
+
+				metric := plugin.MetricType{}
+				fillMetric("overlay_upper_inodes", dfms[2], &metric)
+				So(metric.Data(), ShouldEqual, 5)
+			})
+		})
+
+		Convey("When upperdir walk is limited", func() {
+			fillOverlay(dfms, newOverlayWalker(0, 2, 0))
+
+			Convey("Then size of upperdir is incomplete", func() {
+				size := dfms[2].Overlay.UpperSize
+				So(size.Complete, ShouldBeFalse)
+				So(size.Inodes, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When upperdir is walked again within interval", func() {
+			walker := newOverlayWalker(time.Hour, 0, time.Minute)
+			fillOverlay(dfms, walker)
+			ioutil.WriteFile(filepath.Join(upper, "new"), make([]byte, 10000), 0644)
+			fillOverlay(dfms, walker)
+
+			Convey("Then previous size is reused", func() {
+				So(dfms[2].Overlay.UpperSize.Inodes, ShouldEqual, 5)
+				So(walker.sizes, ShouldContainKey, upper)
+			})
+		})
+
+		Convey("When concrete metric types are listed", func() {
+			fillOverlay(dfms, nil)
+			count := func(walkOverlay bool) int {
+				found := 0
+				for _, m := range concreteMetricTypes(dfms, walkOverlay) {
+					if strings.HasPrefix(m.Namespace()[len(m.Namespace())-1].Value, "overlay_upper_") {
+						found++
+					}
+				}
+				return found
+			}
+
+			Convey("Then usage of upperdir is listed only if walk is enabled", func() {
+				So(count(false), ShouldEqual, 0)
+				So(count(true), ShouldEqual, 2)
+			})
+		})
+	})
+	Convey("Given overlay mount listed in procfs", t, func() {
+		root, _ := ioutil.TempDir("", "df-overlay")
+		defer os.RemoveAll(root)
+		upper := filepath.Join(root, "upper")
+		merged := filepath.Join(root, "merged")
+		os.MkdirAll(upper, 0755)
+		os.MkdirAll(merged, 0755)
+		ioutil.WriteFile(filepath.Join(upper, "file"), make([]byte, 10000), 0644)
+		procPath := filepath.Join(root, "proc")
+		os.MkdirAll(filepath.Join(procPath, "1"), 0755)
+		ioutil.WriteFile(filepath.Join(procPath, "1", MountInfoFile), []byte(fmt.Sprintf(
+			"99 1 8:1 / %s rw,relatime - ext4 /dev/sdx1 rw\n"+
+				"100 1 0:50 / %s rw,relatime - overlay overlay rw,lowerdir=/l1,upperdir=%s,workdir=/w\n", root, merged, upper)), 0644)
+		p := NewDfCollector()
+		p.proc_path = procPath
+		p.overlay_upper_size = true
+
+		Convey("When usage of upperdir is not requested", func() {
+			dfms, err := p.collectFilesystems(p.newCollectionPlan(requestOf("*", "space_free")))
+
+			Convey("Then upperdir is not walked", func() {
+				So(err, ShouldBeNil)
+				So(len(dfms), ShouldEqual, 2)
+				So(dfms[1].Overlay.UpperDir, ShouldEqual, upper)
+				So(dfms[1].Overlay.UpperSize, ShouldBeNil)
+				So(p.overlay_walker.sizes, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When usage of upperdir is requested", func() {
+			dfms, err := p.collectFilesystems(p.newCollectionPlan(requestOf("*", "overlay_upper_bytes")))
+
+			Convey("Then upperdir is walked", func() {
+				So(err, ShouldBeNil)
+				So(dfms[1].Overlay.UpperSize, ShouldNotBeNil)
+				So(dfms[1].Overlay.UpperSize.Inodes, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When only overlay mount is requested", func() {
+			p.keep_original_mountpoint = false
+			dfms, err := p.collectFilesystems(p.newCollectionPlan(requestOf(mountPointName(merged, false), "space_free")))
+
+			Convey("Then filesystem holding upperdir is found among mounts not collected", func() {
+				So(err, ShouldBeNil)
+				So(len(dfms), ShouldEqual, 1)
+				So(dfms[0].Overlay.UpperFS, ShouldEqual, root)
+				So(createTags(dfms[0])["overlay_upper_fs"], ShouldEqual, root)
+			})
+		})
+	})
+}
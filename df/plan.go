@@ -0,0 +1,140 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"strings"
+
+	"github.com/intelsdi-x/snap/control/plugin"
+)
+
+// collectionPlan is compiled from requested namespaces before filesystems
+// are collected, it selects mounts which have to be statfs'd and tells which
+// of expensive metrics are requested
+type collectionPlan struct {
+	// every mount has to be collected
+	all bool
+	// mount elements requested literally
+	mounts map[string]bool
+	// mount elements with wildcards, glob patterns or tuples
+	patterns []string
+	// metric elements of namespaces of filesystems
+	kinds []string
+}
+
+// newCollectionPlan compiles requested namespaces into plan, nil metric types
+// (eg. discovery of metric catalog) select every mount
+func (p *dfCollector) newCollectionPlan(mts []plugin.MetricType) *collectionPlan {
+	plan := &collectionPlan{mounts: map[string]bool{}}
+	// Namespace element of other mounts depends on statfs or on all mounts
+	if mts == nil || p.namespace_key != namespaceKeyMountPoint ||
+		p.deduplicate != deduplicateOff || p.collapse_loop_readonly != collapseLoopOff {
+		plan.all = true
+	}
+	for _, m := range mts {
+		ns := m.Namespace()
+		switch {
+		case len(ns) <= len(namespacePrefix):
+			continue
+		case isDirectoryNamespace(ns):
+			continue
+		case isAggregateNamespace(ns):
+			plan.all = true
+			continue
+		case isQuotaNamespace(ns):
+			plan.addMount(ns[len(namespacePrefix)].Value)
+			continue
+		case len(ns) == len(namespacePrefix)+1:
+			plan.all = true
+			plan.kinds = append(plan.kinds, "*")
+			continue
+		}
+		plan.addMount(ns[len(ns)-2].Value)
+		plan.kinds = append(plan.kinds, ns[len(ns)-1].Value)
+	}
+	return plan
+}
+
+func (plan *collectionPlan) addMount(element string) {
+	switch {
+	case element == "*":
+		plan.all = true
+	case isTuple(element):
+		for _, alt := range alternatives(element) {
+			plan.addMount(alt)
+		}
+	case isLiteral(element):
+		plan.mounts[element] = true
+		// name with suffix added by disambiguation selects all mounts sharing name
+		if i := len(element) - len(nameSuffix("")) - 1; i > 0 && element[i] == '_' && isHex(element[i+1:]) {
+			plan.mounts[element[:i]] = true
+		}
+	default:
+		plan.patterns = append(plan.patterns, element)
+	}
+}
+
+// wants reports whether filesystem read from mountinfo has to be collected,
+// patterns are matched also with suffix added by disambiguation of shared names
+func (plan *collectionPlan) wants(dfm dfMetric) bool {
+	if plan == nil || plan.all || plan.mounts[dfm.MountPoint] {
+		return true
+	}
+	if len(plan.patterns) == 0 {
+		return false
+	}
+	names := []string{
+		dfm.MountPoint,
+		dfm.MountPoint + "_" + nameSuffix(dfm.UnchangedMountPoint),
+		dfm.MountPoint + "_" + nameSuffix(dfm.UnchangedMountPoint+"\x00"+dfm.MountID),
+	}
+	for _, name := range names {
+		for _, pattern := range plan.patterns {
+			if matchGlob(pattern, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Return true if metric of given kind is requested by any of namespaces of filesystems
+func (plan *collectionPlan) requested(kind string) bool {
+	if plan == nil {
+		return false
+	}
+	for _, element := range plan.kinds {
+		if matchElement(element, kind) {
+			return true
+		}
+	}
+	return false
+}
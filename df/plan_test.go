@@ -0,0 +1,189 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/intelsdi-x/snap/control/plugin"
+	"github.com/intelsdi-x/snap/core"
+	"github.com/intelsdi-x/snap/core/cdata"
+	"github.com/intelsdi-x/snap/core/ctypes"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// makeMounts writes mountinfo listing given number of directories mounted
+// under root, it returns path of fake procfs
+func makeMounts(root string, count int) string {
+	procPath := filepath.Join(root, "proc")
+	os.MkdirAll(filepath.Join(procPath, "1"), 0755)
+	lines := []string{}
+	for i := 0; i < count; i++ {
+		dir := filepath.Join(root, "mnt", fmt.Sprintf("m%05d", i))
+		os.MkdirAll(dir, 0755)
+		lines = append(lines, fmt.Sprintf("%d 1 8:%d / %s rw,relatime - ext4 /dev/sdx%d rw", 100+i, i, dir, i))
+	}
+	ioutil.WriteFile(filepath.Join(procPath, "1", MountInfoFile), []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	return procPath
+}
+
+func requestOf(elements ...string) []plugin.MetricType {
+	return []plugin.MetricType{{Namespace_: core.NewNamespace(append(append([]string{}, namespacePrefix...), elements...)...)}}
+}
+
+func TestCollectionPlan(t *testing.T) {
+	Convey("Given df collector", t, func() {
+		p := NewDfCollector()
+
+		Convey("Then mounts requested by name are selected", func() {
+			plan := p.newCollectionPlan(requestOf("(data|srv)", "space_free"))
+			So(plan.all, ShouldBeFalse)
+			So(plan.wants(dfMetric{MountPoint: "data", UnchangedMountPoint: "/data"}), ShouldBeTrue)
+			So(plan.wants(dfMetric{MountPoint: "home", UnchangedMountPoint: "/home"}), ShouldBeFalse)
+			So(plan.requested("space_free"), ShouldBeTrue)
+			So(plan.requested("open_files"), ShouldBeFalse)
+		})
+
+		Convey("Then mounts with disambiguated names are selected", func() {
+			name := "data_a_" + nameSuffix("/data_a")
+			plan := p.newCollectionPlan(requestOf(name, "*"))
+			So(plan.wants(dfMetric{MountPoint: "data_a", UnchangedMountPoint: "/data_a"}), ShouldBeTrue)
+			So(plan.requested("open_files"), ShouldBeTrue)
+		})
+
+		Convey("Then mounts matching patterns are selected", func() {
+			plan := p.newCollectionPlan(requestOf("data*", "space_free"))
+			So(plan.wants(dfMetric{MountPoint: "data_1", UnchangedMountPoint: "/data/1"}), ShouldBeTrue)
+			So(plan.wants(dfMetric{MountPoint: "srv", UnchangedMountPoint: "/srv"}), ShouldBeFalse)
+		})
+
+		Convey("Then every mount is selected when needed", func() {
+			So(p.newCollectionPlan(nil).all, ShouldBeTrue)
+			So(p.newCollectionPlan(requestOf("*")).all, ShouldBeTrue)
+			So(p.newCollectionPlan(requestOf("*", "space_free")).all, ShouldBeTrue)
+			So(p.newCollectionPlan(requestOf(nsTotal, "space_free")).all, ShouldBeTrue)
+			p.deduplicate = deduplicateDevice
+			So(p.newCollectionPlan(requestOf("data", "space_free")).all, ShouldBeTrue)
+		})
+
+		Convey("Then watched directories do not select mounts", func() {
+			plan := p.newCollectionPlan(requestOf(nsDirectory, "var_log", "dir_bytes"))
+			So(plan.all, ShouldBeFalse)
+			So(plan.mounts, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given host with many mounts", t, func() {
+		root, _ := ioutil.TempDir("", "df-plan")
+		defer os.RemoveAll(root)
+		procPath := makeMounts(root, 20)
+		name := mountPointName(filepath.Join(root, "mnt", "m00007"), false)
+		p := NewDfCollector()
+		dfs := &dfStats{cache: map[string]dfMetric{}}
+
+		Convey("When single mount is requested", func() {
+			dfms, err := dfs.collect(procPath, nil, nil, false, refreshIntervals{}, p.newCollectionPlan(requestOf(name, "space_free")))
+
+			Convey("Then only requested mount is collected", func() {
+				So(err, ShouldBeNil)
+				So(len(dfms), ShouldEqual, 1)
+				So(dfms[0].MountPoint, ShouldEqual, name)
+				So(dfms[0].Blocks, ShouldBeGreaterThan, 0)
+			})
+		})
+
+		Convey("When every mount is requested", func() {
+			dfms, err := dfs.collect(procPath, nil, nil, false, refreshIntervals{}, p.newCollectionPlan(requestOf("*", "space_free")))
+			So(err, ShouldBeNil)
+			So(len(dfms), ShouldEqual, 20)
+		})
+	})
+
+	Convey("Given concrete catalog of host with default configuration", t, func() {
+		root, _ := ioutil.TempDir("", "df-plan")
+		defer os.RemoveAll(root)
+		node := cdata.NewNode()
+		node.AddItem(ProcPath, ctypes.ConfigValueStr{Value: makeMounts(root, 20)})
+		node.AddItem(CatalogMode, ctypes.ConfigValueStr{Value: catalogConcrete})
+		p := NewDfCollector()
+		mts, err := p.GetMetricTypes(plugin.ConfigType{ConfigDataNode: node})
+		So(err, ShouldBeNil)
+		mountPoint := filepath.Join(root, "mnt", "m00007")
+		requested := []plugin.MetricType{}
+		for _, m := range mts {
+			if m.Namespace()[3].Value == mountPoint && m.Namespace()[4].Value == "space_free" {
+				requested = append(requested, plugin.MetricType{Namespace_: m.Namespace(), Config_: node})
+			}
+		}
+		So(len(requested), ShouldEqual, 1)
+
+		Convey("When listed metric is collected", func() {
+			metrics, err := p.CollectMetrics(requested)
+
+			Convey("Then only listed mount is collected", func() {
+				So(err, ShouldBeNil)
+				So(len(metrics), ShouldEqual, 1)
+				So(metrics[0].Namespace()[3].Value, ShouldEqual, mountPoint)
+			})
+		})
+	})
+}
+
+func benchmarkCollect(b *testing.B, expected int, elements ...string) {
+	root, _ := ioutil.TempDir("", "df-plan")
+	defer os.RemoveAll(root)
+	procPath := makeMounts(root, 5000)
+	if elements[0] == "" {
+		elements[0] = mountPointName(filepath.Join(root, "mnt", "m01234"), false)
+	}
+	p := NewDfCollector()
+	p.stats = &dfStats{cache: map[string]dfMetric{}}
+	node := cdata.NewNode()
+	node.AddItem(ProcPath, ctypes.ConfigValueStr{Value: procPath})
+	node.AddItem(KeepOriginalMountPoint, ctypes.ConfigValueBool{Value: false})
+	mts := requestOf(elements...)
+	mts[0].Config_ = node
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		metrics, err := p.CollectMetrics(mts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(metrics) != expected {
+			b.Fatalf("got %d metrics, expected %d", len(metrics), expected)
+		}
+	}
+	b.StopTimer()
+}
+
+// BenchmarkCollectSingleMount requests one of 5000 mounts, only it is statfs'd
+func BenchmarkCollectSingleMount(b *testing.B) {
+	benchmarkCollect(b, 1, "", "space_free")
+}
+
+// BenchmarkCollectAllMounts requests the same metric of all 5000 mounts
+func BenchmarkCollectAllMounts(b *testing.B) {
+	benchmarkCollect(b, 5000, "*", "space_free")
+}
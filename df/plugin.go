@@ -23,10 +23,10 @@ package df
 
 import (
 	"bufio"
-	"errors"
 	"fmt"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -51,15 +51,48 @@ const (
 	nsType   = "filesystem"
 
 	ProcPath               = "proc_path"
+	SysPath                = "sys_path"
+	DevPath                = "dev_path"
 	ExcludedFSNames        = "excluded_fs_names"
 	ExcludedFSTypes        = "excluded_fs_types"
 	KeepOriginalMountPoint = "keep_original_mountpoint"
+	RefreshIntervals       = "refresh_intervals"
+	CollapseLoopReadOnly   = "collapse_loop_readonly"
+	NamespaceKey           = "namespace_key"
+	OverlayUpperSize       = "overlay_upper_size"
+	OverlayWalkMaxFiles    = "overlay_walk_max_files"
+	OverlayWalkInterval    = "overlay_walk_interval"
+	OverlayWalkTimeBudget  = "overlay_walk_time_budget"
+	Attribution            = "attribution"
+	AttributionNames       = "attribution_resolve_names"
+	WatchedDirectories     = "watched_directories"
+	DirectoryMaxDepth      = "directory_max_depth"
+	DirectoryMaxFiles      = "directory_max_files"
+	DirectoryTimeBudget    = "directory_time_budget"
+	DirectoryTopChildren   = "directory_top_children"
+	DirectoryIncremental   = "directory_incremental"
+	DirectoryCacheEntries  = "directory_cache_max_entries"
+	DirectoryCacheMaxAge   = "directory_cache_max_age"
+	DeletedOpenTop         = "deleted_open_top_processes"
+	ProcessScanInterval    = "process_scan_interval"
+	ProcessScanMax         = "process_scan_max_processes"
+	ProcessesUsingTop      = "processes_using_top"
+	Quota                  = "quota"
+	QuotaTop               = "quota_top"
+	MetricLayout           = "metric_layout"
+	Deduplicate            = "deduplicate"
+	CatalogMode            = "catalog_mode"
+	DeduplicatePrefer      = "deduplicate_prefer"
 	MountInfoFile          = "mountinfo"
 )
 
 var (
 	//procPath source of data for metrics
 	procPath = "/proc"
+	//sysPath source of block devices attributes
+	sysPath = "/sys"
+	//devPath source of persistent block devices names
+	devPath = "/dev"
 	// prefix in metric namespace
 	namespacePrefix = []string{nsVendor, nsClass, nsType}
 	metricsKind     = []string{
@@ -77,6 +110,20 @@ var (
 		"inodes_percent_used",
 		"device_name",
 		"device_type",
+		"cache_age_seconds",
+		"md_level",
+		"md_devices_active",
+		"md_devices_failed",
+		"md_devices_spare",
+		"md_degraded",
+		"md_sync_action",
+		"md_sync_percent",
+		"md_sync_speed",
+		"overlay_upper_bytes",
+		"overlay_upper_inodes",
+		"space_deleted_open",
+		"open_files",
+		"processes_using",
 	}
 	dfltExcludedFSNames = []string{
 		"/proc/sys/fs/binfmt_misc",
@@ -102,44 +149,73 @@ var (
 		"tmpfs",
 		"aufs",
 	}
+	// limit of files visited when computing size of overlay upperdir
+	dfltOverlayWalkMaxFiles = 100000
+	// minimal interval between walks of the same overlay upperdir
+	dfltOverlayWalkInterval = 5 * time.Minute
+	// limit of duration of single walk of overlay upperdir
+	dfltOverlayWalkTimeBudget = 10 * time.Second
 )
 
+// checkDirectory returns error naming configuration item if path is not a directory
+func checkDirectory(key string, dir string) error {
+	stats, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("%s: %s", key, err)
+	}
+	if !stats.IsDir() {
+		return fmt.Errorf("%s: %s is not a directory", key, dir)
+	}
+	return nil
+}
+
 // Function to check properness of configuration parameter
 // and set plugin attribute accordingly
 func (p *dfCollector) setProcPath(cfg interface{}) error {
-	p.initializedMutex.Lock()
-	defer p.initializedMutex.Unlock()
-	if p.initialized {
-		return nil
-	}
 	procPath, err := config.GetConfigItem(cfg, ProcPath)
 	if err == nil && len(procPath.(string)) > 0 {
-		procPathStats, err := os.Stat(procPath.(string))
-		if err != nil {
+		if err := checkDirectory(ProcPath, procPath.(string)); err != nil {
 			return err
 		}
-		if !procPathStats.IsDir() {
-			return errors.New(fmt.Sprintf("%s is not a directory", procPath.(string)))
+		mountInfo := path.Join(procPath.(string), "1", MountInfoFile)
+		if _, err := os.Stat(mountInfo); err != nil {
+			return fmt.Errorf("%s: %s is not procfs, %s is not readable: %s", ProcPath, procPath.(string), mountInfo, err)
 		}
 		p.proc_path = procPath.(string)
 	}
+	sysPath, err := config.GetConfigItem(cfg, SysPath)
+	if err == nil && len(sysPath.(string)) > 0 {
+		if err := checkDirectory(SysPath, sysPath.(string)); err != nil {
+			return err
+		}
+		p.sys_path = sysPath.(string)
+	}
+	devPath, err := config.GetConfigItem(cfg, DevPath)
+	if err == nil && len(devPath.(string)) > 0 {
+		if err := checkDirectory(DevPath, devPath.(string)); err != nil {
+			return err
+		}
+		p.dev_path = devPath.(string)
+	}
 	excludedFSNames, err := config.GetConfigItem(cfg, ExcludedFSNames)
 	if err == nil {
-		if len(excludedFSNames.(string)) > 0 {
-			p.excluded_fs_names = strings.Split(excludedFSNames.(string), ",")
-		} else {
-			p.excluded_fs_names = []string{}
+		names, err := parseList(ExcludedFSNames, excludedFSNames.(string))
+		if err != nil {
+			return err
 		}
+		warnRelativeMountPoints(ExcludedFSNames, names)
+		p.excluded_fs_names = names
 	} else {
 		p.excluded_fs_names = dfltExcludedFSNames
 	}
 	excludedFSTypes, err := config.GetConfigItem(cfg, ExcludedFSTypes)
 	if err == nil {
-		if len(excludedFSTypes.(string)) > 0 {
-			p.excluded_fs_types = strings.Split(excludedFSTypes.(string), ",")
-		} else {
-			p.excluded_fs_types = []string{}
+		types, err := parseList(ExcludedFSTypes, excludedFSTypes.(string))
+		if err != nil {
+			return err
 		}
+		warnUnknownFSTypes(ExcludedFSTypes, p.proc_path, types)
+		p.excluded_fs_types = types
 	} else {
 		p.excluded_fs_types = dfltExcludedFSTypes
 	}
@@ -147,128 +223,483 @@ func (p *dfCollector) setProcPath(cfg interface{}) error {
 	if err == nil {
 		p.keep_original_mountpoint = keepMount.(bool)
 	}
-	p.initialized = true
+	refresh, err := config.GetConfigItem(cfg, RefreshIntervals)
+	if err == nil {
+		intervals, err := parseRefreshIntervals(refresh.(string))
+		if err != nil {
+			return err
+		}
+		p.refresh_intervals = intervals
+	}
+	collapseLoop, err := config.GetConfigItem(cfg, CollapseLoopReadOnly)
+	if err == nil {
+		if err := validateCollapseLoop(collapseLoop.(string)); err != nil {
+			return err
+		}
+		p.collapse_loop_readonly = collapseLoop.(string)
+	}
+	namespaceKey, err := config.GetConfigItem(cfg, NamespaceKey)
+	if err == nil {
+		if err := validateNamespaceKey(namespaceKey.(string)); err != nil {
+			return err
+		}
+		p.namespace_key = namespaceKey.(string)
+	}
+	overlayUpperSize, err := config.GetConfigItem(cfg, OverlayUpperSize)
+	if err == nil {
+		p.overlay_upper_size = overlayUpperSize.(bool)
+	}
+	walkMaxFiles := dfltOverlayWalkMaxFiles
+	overlayMaxFiles, err := config.GetConfigItem(cfg, OverlayWalkMaxFiles)
+	if err == nil {
+		walkMaxFiles = overlayMaxFiles.(int)
+	}
+	walkInterval := dfltOverlayWalkInterval
+	overlayInterval, err := config.GetConfigItem(cfg, OverlayWalkInterval)
+	if err == nil {
+		walkInterval, err = time.ParseDuration(overlayInterval.(string))
+		if err != nil {
+			return fmt.Errorf("%s: wrong duration: %s", OverlayWalkInterval, err)
+		}
+	}
+	walkBudget := dfltOverlayWalkTimeBudget
+	overlayBudget, err := config.GetConfigItem(cfg, OverlayWalkTimeBudget)
+	if err == nil {
+		walkBudget, err = time.ParseDuration(overlayBudget.(string))
+		if err != nil {
+			return fmt.Errorf("%s: wrong duration: %s", OverlayWalkTimeBudget, err)
+		}
+	}
+	p.overlay_walker = newOverlayWalker(walkInterval, walkMaxFiles, walkBudget)
+	resolveNames := false
+	attributionNames, err := config.GetConfigItem(cfg, AttributionNames)
+	if err == nil {
+		resolveNames = attributionNames.(bool)
+	}
+	attribution, err := config.GetConfigItem(cfg, Attribution)
+	if err == nil {
+		attributors, err := newAttributors(attribution.(string), resolveNames)
+		if err != nil {
+			return err
+		}
+		p.attributors = attributors
+	}
+	watched, err := config.GetConfigItem(cfg, WatchedDirectories)
+	if err == nil {
+		paths, err := parseWatchedDirectories(watched.(string))
+		if err != nil {
+			return err
+		}
+		p.directories.paths = paths
+	}
+	dirMaxDepth, err := config.GetConfigItem(cfg, DirectoryMaxDepth)
+	if err == nil {
+		p.directories.maxDepth = dirMaxDepth.(int)
+	}
+	dirMaxFiles, err := config.GetConfigItem(cfg, DirectoryMaxFiles)
+	if err == nil {
+		p.directories.maxFiles = dirMaxFiles.(int)
+	}
+	dirTimeBudget, err := config.GetConfigItem(cfg, DirectoryTimeBudget)
+	if err == nil {
+		budget, err := time.ParseDuration(dirTimeBudget.(string))
+		if err != nil {
+			return fmt.Errorf("%s: wrong duration: %s", DirectoryTimeBudget, err)
+		}
+		p.directories.timeBudget = budget
+	}
+	dirTopChildren, err := config.GetConfigItem(cfg, DirectoryTopChildren)
+	if err == nil {
+		p.directories.topChildren = dirTopChildren.(int)
+	}
+	dirIncremental, err := config.GetConfigItem(cfg, DirectoryIncremental)
+	if err == nil && dirIncremental.(bool) {
+		maxEntries := dfltDirectoryCacheMaxEntries
+		dirCacheEntries, err := config.GetConfigItem(cfg, DirectoryCacheEntries)
+		if err == nil {
+			maxEntries = dirCacheEntries.(int)
+		}
+		maxAge := dfltDirectoryCacheMaxAge
+		dirCacheMaxAge, err := config.GetConfigItem(cfg, DirectoryCacheMaxAge)
+		if err == nil {
+			maxAge, err = time.ParseDuration(dirCacheMaxAge.(string))
+			if err != nil {
+				return fmt.Errorf("%s: wrong duration: %s", DirectoryCacheMaxAge, err)
+			}
+		}
+		p.dir_cache = newDirCache(maxEntries, maxAge)
+	}
+	deletedOpenTop, err := config.GetConfigItem(cfg, DeletedOpenTop)
+	if err == nil {
+		p.deleted_open_top = deletedOpenTop.(int)
+	}
+	scanInterval := dfltProcessScanInterval
+	processScanInterval, err := config.GetConfigItem(cfg, ProcessScanInterval)
+	if err == nil {
+		scanInterval, err = time.ParseDuration(processScanInterval.(string))
+		if err != nil {
+			return fmt.Errorf("%s: wrong duration: %s", ProcessScanInterval, err)
+		}
+	}
+	scanMax := dfltProcessScanMaxProcesses
+	processScanMax, err := config.GetConfigItem(cfg, ProcessScanMax)
+	if err == nil {
+		scanMax = processScanMax.(int)
+	}
+	p.process_scanner = newProcessScanner(scanInterval, scanMax)
+	processesUsingTop, err := config.GetConfigItem(cfg, ProcessesUsingTop)
+	if err == nil {
+		p.processes_using_top = processesUsingTop.(int)
+	}
+	quota, err := config.GetConfigItem(cfg, Quota)
+	if err == nil {
+		p.quota = quota.(bool)
+	}
+	quotaTop, err := config.GetConfigItem(cfg, QuotaTop)
+	if err == nil {
+		p.quota_top = quotaTop.(int)
+	}
+	metricLayout, err := config.GetConfigItem(cfg, MetricLayout)
+	if err == nil {
+		if err := validateMetricLayout(metricLayout.(string)); err != nil {
+			return err
+		}
+		p.metric_layout = metricLayout.(string)
+	}
+	dedupMode, err := config.GetConfigItem(cfg, Deduplicate)
+	if err == nil {
+		p.deduplicate = dedupMode.(string)
+	}
+	dedupPrefer, err := config.GetConfigItem(cfg, DeduplicatePrefer)
+	if err == nil {
+		p.deduplicate_prefer = dedupPrefer.(string)
+	}
+	if err := validateDeduplicate(p.deduplicate, p.deduplicate_prefer); err != nil {
+		return err
+	}
 	return nil
 }
 
 // GetMetricTypes returns list of available metric types
 // It returns error in case retrieval was not successful
 func (p *dfCollector) GetMetricTypes(cfg plugin.ConfigType) ([]plugin.MetricType, error) {
+	mode := catalogWildcard
+	catalogMode, err := config.GetConfigItem(cfg, CatalogMode)
+	if err == nil {
+		if err := validateCatalogMode(catalogMode.(string)); err != nil {
+			return nil, err
+		}
+		mode = catalogMode.(string)
+	}
 	mts := []plugin.MetricType{}
-	for _, kind := range metricsKind {
-		mts = append(mts, plugin.MetricType{
-			Namespace_: core.NewNamespace(namespacePrefix...).
-				AddDynamicElement(nsType, "name of filesystem").
-				AddStaticElement(kind),
-			Description_: "dynamic filesystem metric: " + kind,
-		})
+	if mode != catalogConcrete {
+		for _, kind := range metricsKind {
+			mts = append(mts, plugin.MetricType{
+				Namespace_: core.NewNamespace(namespacePrefix...).
+					AddDynamicElement(nsType, "name of filesystem").
+					AddStaticElement(kind),
+				Description_: "dynamic filesystem metric: " + kind,
+			})
+		}
 	}
+	if mode != catalogWildcard {
+		// Discovery uses configuration of catalog without changing
+		// configuration used for collection
+		discovery, err := p.configured(configKey(cfg.ConfigDataNode), cfg)
+		if err != nil {
+			return nil, err
+		}
+		dfms, err := discovery.collectFilesystems(discovery.newCollectionPlan(nil))
+		if err != nil {
+			return nil, err
+		}
+		mts = append(mts, concreteMetricTypes(dfms, discovery.overlay_upper_size)...)
+	}
+	mts = append(mts, directoryMetricTypes()...)
+	mts = append(mts, quotaMetricTypes()...)
+	mts = append(mts, aggregateMetricTypes()...)
+	setUnits(mts)
 	return mts, nil
 }
 
 // CollectMetrics returns list of requested metric values
 // It returns error in case retrieval was not successful
 func (p *dfCollector) CollectMetrics(mts []plugin.MetricType) ([]plugin.MetricType, error) {
-	err := p.setProcPath(mts[0])
-	if err != nil {
-		return nil, err
+	// Requests of tasks with different configuration are collected separately
+	keys, groups := groupByConfig(mts)
+	metrics := []plugin.MetricType{}
+	for _, key := range keys {
+		c, err := p.configured(key, groups[key][0])
+		if err != nil {
+			return nil, err
+		}
+		collected, err := c.collectRequests(groups[key])
+		if err != nil {
+			return collected, err
+		}
+		metrics = append(metrics, collected...)
 	}
+	return metrics, nil
+}
+
+// collectRequests returns values of metric types sharing configuration
+func (p *dfCollector) collectRequests(mts []plugin.MetricType) ([]plugin.MetricType, error) {
 	metrics := []plugin.MetricType{}
 	curTime := time.Now()
-	dfms, err := p.stats.collect(p.proc_path, p.excluded_fs_names, p.excluded_fs_types, p.keep_original_mountpoint)
+	keep := keepMountPoint(p.metric_layout, p.keep_original_mountpoint)
+	dfms, err := p.collectFilesystems(p.newCollectionPlan(mts))
 	if err != nil {
-		return metrics, fmt.Errorf(fmt.Sprintf("Unable to collect metrics from df: %s", err))
+		return metrics, err
+	}
+	// Filesystems requested by name are looked up in index
+	all := make([]int, len(dfms))
+	byName := map[string][]int{}
+	for i := range dfms {
+		all[i] = i
+		byName[dfms[i].MountPoint] = append(byName[dfms[i].MountPoint], i)
 	}
+	// Watched directories are walked and quotas are read only when requested
+	var dms []dirMetric
+	quotasRead := false
 	for _, m := range mts {
 		ns := m.Namespace()
 		lns := len(ns)
 		if lns < 4 {
 			return nil, fmt.Errorf("Wrong namespace length %d: should be at least 4", lns)
 		}
+		// namespace /intel/procfs/filesystem/directory/<path>/...
+		if isDirectoryNamespace(ns) {
+			if _, err := matchingKinds(ns[lns-1].Value, dirMetricsKind); err != nil {
+				return nil, err
+			}
+			if dms == nil {
+				dms = collectDirectories(p.directories, p.dir_cache, p.excluded_fs_names, keep)
+			}
+			metrics = append(metrics, directoryMetrics(ns, dms, keep)...)
+			continue
+		}
+		// namespace /intel/procfs/filesystem/<fs>/quota/<type>/<id>/<metric>
+		if isQuotaNamespace(ns) {
+			if _, err := matchingKinds(ns[lns-1].Value, quotaMetricsKind); err != nil {
+				return nil, err
+			}
+			if !p.quota {
+				continue
+			}
+			if !quotasRead {
+				fillQuotas(p.quota_reader, dfms, p.quota_top)
+				quotasRead = true
+			}
+			metrics = append(metrics, quotaMetrics(ns, dfms, curTime)...)
+			continue
+		}
+		// namespace /intel/procfs/filesystem/_total/<metric> or /intel/procfs/filesystem/_by_type/<type>/<metric>
+		if isAggregateNamespace(ns) {
+			if _, err := matchingKinds(ns[lns-1].Value, aggregateMetricsKind); err != nil {
+				return nil, err
+			}
+			metrics = append(metrics, aggregateMetrics(ns, dfms, curTime)...)
+			continue
+		}
 		// We can request all metrics for all devices in one shot
 		// using namespace /intel/procfs/filesystem/*
+		mountElement, kindElement := "*", "*"
 		if lns == 4 {
 			if ns[lns-1].Value != "*" {
 				return nil, fmt.Errorf("Namespace should contain wildcard")
 			}
-			for _, kind := range metricsKind {
-				for _, dfm := range dfms {
-					metric := createMetric(
-						core.NewNamespace(
-							createNamespace(dfm.MountPoint, kind)...),
-						curTime)
-					fillMetric(kind, dfm, &metric)
-					metrics = append(metrics, metric)
-				}
-			}
-		} else if ns[lns-2].Value == "*" {
-			// namespace /intel/procfs/filesystem/*/<metric>
-			kind := ns[lns-1].Value
-			// <metric> is also wildcard => get them all
-			if kind == "*" {
-				for _, skind := range metricsKind {
-					for _, dfm := range dfms {
-						metric := createMetric(
-							core.NewNamespace(
-								createNamespace(dfm.MountPoint, skind)...),
-							curTime)
-						fillMetric(skind, dfm, &metric)
-						metrics = append(metrics, metric)
-					}
-				}
-			} else {
-				// <metric> is not wildcard => getonly matching metrics
-				for _, dfm := range dfms {
-					metric := createMetric(
-						core.NewNamespace(
-							createNamespace(dfm.MountPoint, kind)...),
-						curTime)
-					fillMetric(kind, dfm, &metric)
-					metrics = append(metrics, metric)
-				}
-			}
 		} else {
-			// namespace /intel/procfs/filesystem/<fs>/<metric>
-			kind := ns[lns-1].Value
-			// <metric> is also wildcard => get them all
-			if kind == "*" {
-				for _, skind := range metricsKind {
-					for _, dfm := range dfms {
-						if ns[lns-2].Value == dfm.MountPoint {
-							metric := createMetric(
-								core.NewNamespace(
-									createNamespace(dfm.MountPoint, skind)...),
-								curTime)
-							fillMetric(skind, dfm, &metric)
-							metrics = append(metrics, metric)
-						}
-					}
+			// namespace /intel/procfs/filesystem/<fs>/<metric>, where both
+			// elements may be wildcards, glob patterns or tuples
+			mountElement, kindElement = ns[lns-2].Value, ns[lns-1].Value
+		}
+		kinds, err := matchingKinds(kindElement, metricsKind)
+		if err != nil {
+			return nil, err
+		}
+		idxs := all
+		if isLiteral(mountElement) {
+			idxs = byName[mountElement]
+		}
+		for _, kind := range kinds {
+			for _, i := range idxs {
+				dfm := dfms[i]
+				if !matchElement(mountElement, dfm.MountPoint) || !hasMetric(kind, dfm) {
+					continue
 				}
-			} else {
-				for _, dfm := range dfms {
-					if ns[lns-2].Value == dfm.MountPoint {
-						metric := createMetric(ns, curTime)
-						fillMetric(kind, dfm, &metric)
-						metrics = append(metrics, metric)
-					}
+				metric := createMetric(
+					core.NewNamespace(
+						createNamespace(dfm.MountPoint, kind)...),
+					dfm, curTime)
+				if err := fillMetric(kind, dfm, &metric); err != nil {
+					return nil, err
 				}
+				metrics = append(metrics, metric)
 			}
 		}
 	}
 	return metrics, nil
 }
 
-func createMetric(ns core.Namespace, curTime time.Time) plugin.MetricType {
+func createMetric(ns core.Namespace, dfm dfMetric, curTime time.Time) plugin.MetricType {
+	// Values served from cache keep time of their collection
+	if !dfm.Timestamp.IsZero() {
+		curTime = dfm.Timestamp
+	}
 	metric := plugin.MetricType{
 		Timestamp_: curTime,
 		Namespace_: ns,
+		Tags_:      createTags(dfm),
 	}
 	ns[len(ns)-2].Name = nsType
 	return metric
 }
 
+// createTags returns tags describing filesystem the metric relates to
+func createTags(dfm dfMetric) map[string]string {
+	tags := map[string]string{
+		"remote": strconv.FormatBool(dfm.Remote),
+	}
+	if dfm.UnchangedMountPoint != "" {
+		tags["mount_point_original"] = dfm.UnchangedMountPoint
+	}
+	// Mount point and device are not part of namespace keyed by other identity
+	if dfm.KeyedBy != "" {
+		tags["mount_point"] = dfm.UnchangedMountPoint
+		tags["device"] = dfm.Filesystem
+	}
+	if dfm.MajorMinor != "" {
+		tags["majmin"] = dfm.MajorMinor
+	}
+	if len(dfm.Aliases) > 0 {
+		tags["mount_aliases"] = aliasesTag(dfm.Aliases)
+	}
+	if dfm.FSID != "" {
+		tags["fsid"] = dfm.FSID
+	}
+	if dfm.DiskIDs.UUID != "" {
+		tags["uuid"] = dfm.DiskIDs.UUID
+	}
+	if dfm.DiskIDs.Label != "" {
+		tags["label"] = dfm.DiskIDs.Label
+	}
+	if dfm.DiskIDs.PartUUID != "" {
+		tags["partuuid"] = dfm.DiskIDs.PartUUID
+	}
+	if dfm.DiskIDs.ID != "" {
+		tags["device_id"] = dfm.DiskIDs.ID
+	}
+	if dfm.RemoteHost != "" {
+		tags["remote_host"] = dfm.RemoteHost
+	}
+	if dfm.RemoteExport != "" {
+		tags["remote_export"] = dfm.RemoteExport
+	}
+	if dfm.DeviceKernelName != "" {
+		tags["device_kernel_name"] = dfm.DeviceKernelName
+	}
+	if dfm.DMName != "" {
+		tags["dm_name"] = dfm.DMName
+	}
+	if dfm.LVMVG != "" {
+		tags["lvm_vg"] = dfm.LVMVG
+		tags["lvm_lv"] = dfm.LVMLV
+	}
+	if dfm.Crypt != "" {
+		tags["crypt"] = dfm.Crypt
+	}
+	if dfm.Loop != nil {
+		if dfm.Loop.BackingFile != "" {
+			tags["loop_backing_file"] = dfm.Loop.BackingFile
+			tags["loop_offset"] = strconv.FormatUint(dfm.Loop.Offset, 10)
+			tags["loop_autoclear"] = strconv.FormatBool(dfm.Loop.Autoclear)
+		}
+		tags["loop_package"] = dfm.Loop.Package
+		tags["loop_images"] = strconv.Itoa(dfm.Loop.Images)
+	}
+	if dfm.Overlay != nil {
+		tags["overlay_lower_layers"] = strconv.Itoa(len(dfm.Overlay.LowerDirs))
+		if dfm.Overlay.UpperDir != "" {
+			tags["overlay_upper_dir"] = dfm.Overlay.UpperDir
+		}
+		if dfm.Overlay.UpperFS != "" {
+			tags["overlay_upper_fs"] = dfm.Overlay.UpperFS
+		}
+		if dfm.Overlay.UpperSize != nil {
+			tags["overlay_upper_complete"] = strconv.FormatBool(dfm.Overlay.UpperSize.Complete)
+		}
+	}
+	if len(dfm.BackingDisks) > 0 {
+		for k, v := range backingDisksTags(dfm.BackingDisks) {
+			tags[k] = v
+		}
+	}
+	if dfm.DeletedOpen != nil && len(dfm.DeletedOpen.Processes) > 0 {
+		tags["deleted_open_processes"] = deletedOpenTag(dfm.DeletedOpen)
+	}
+	if dfm.Usage != nil && len(dfm.Usage.Top) > 0 {
+		tags["using_processes"] = usingProcessesTag(dfm.Usage)
+	}
+	for k, v := range dfm.Attributes {
+		tags[k] = v
+	}
+	return tags
+}
+
+// collectFilesystems returns filesystems selected by plan with attributes filled
+// by all stages, scans of processes are done only if plan requests their results
+func (p *dfCollector) collectFilesystems(plan *collectionPlan) ([]dfMetric, error) {
+	keep := keepMountPoint(p.metric_layout, p.keep_original_mountpoint)
+	dfms, err := p.stats.collect(p.proc_path, p.excluded_fs_names, p.excluded_fs_types, keep, p.refresh_intervals, plan)
+	if err != nil {
+		return nil, fmt.Errorf(fmt.Sprintf("Unable to collect metrics from df: %s", err))
+	}
+	for i := range dfms {
+		fillBlockDevice(p.sys_path, &dfms[i])
+	}
+	fillMdRaid(p.proc_path, p.sys_path, dfms)
+	fillDiskIDs(p.dev_path, dfms)
+	// Walking writable layers of overlays is expensive, done only when requested
+	var walker *overlayWalker
+	if p.overlay_upper_size && (plan.requested("overlay_upper_bytes") || plan.requested("overlay_upper_inodes")) {
+		walker = p.overlay_walker
+	}
+	fillOverlay(dfms, walker)
+	// Scanning descriptors of all processes is expensive, done only when requested
+	if plan.requested("space_deleted_open") {
+		fillDeletedOpen(p.process_scanner, p.proc_path, dfms, p.deleted_open_top)
+	}
+	if plan.requested("open_files") || plan.requested("processes_using") {
+		fillMountUsage(p.process_scanner, p.proc_path, dfms, p.processes_using_top)
+	}
+	dfms = collapseLoopReadOnly(dfms, p.collapse_loop_readonly, keep)
+	dfms = deduplicate(dfms, p.deduplicate, p.deduplicate_prefer)
+	applyNamespaceKey(dfms, p.namespace_key)
+	disambiguateNames(dfms)
+	applyMetricLayout(dfms, p.metric_layout)
+	attribute(p.attributors, dfms)
+	return dfms, nil
+}
+
+// Return true if metric of given kind is available for filesystem
+func hasMetric(kind string, dfm dfMetric) bool {
+	if strings.HasPrefix(kind, "md_") {
+		return dfm.MdRaid != nil
+	}
+	if strings.HasPrefix(kind, "overlay_") {
+		return dfm.Overlay != nil && dfm.Overlay.UpperSize != nil
+	}
+	if kind == "space_deleted_open" {
+		return dfm.DeletedOpen != nil
+	}
+	if kind == "open_files" || kind == "processes_using" {
+		return dfm.Usage != nil
+	}
+	return true
+}
+
 // Function to fill metric with proper (computed) value
-func fillMetric(kind string, dfm dfMetric, metric *plugin.MetricType) {
+func fillMetric(kind string, dfm dfMetric, metric *plugin.MetricType) error {
 	switch kind {
 	case "space_free":
 		metric.Data_ = dfm.Available
@@ -298,7 +729,35 @@ func fillMetric(kind string, dfm dfMetric, metric *plugin.MetricType) {
 		metric.Data_ = ceilPercent(dfm.Inodes-(dfm.IUsed+dfm.IFree), dfm.Inodes)
 	case "inodes_percent_used":
 		metric.Data_ = ceilPercent(dfm.IUsed, dfm.Inodes)
+	case "cache_age_seconds":
+		metric.Data_ = 0.0
+		if !dfm.Timestamp.IsZero() {
+			metric.Data_ = time.Since(dfm.Timestamp).Seconds()
+		}
+	case "space_deleted_open":
+		if dfm.DeletedOpen != nil {
+			metric.Data_ = dfm.DeletedOpen.Bytes / 1024
+		}
+	case "open_files":
+		if dfm.Usage != nil {
+			metric.Data_ = dfm.Usage.OpenFiles
+		}
+	case "processes_using":
+		if dfm.Usage != nil {
+			metric.Data_ = dfm.Usage.Processes
+		}
+	default:
+		if dfm.MdRaid != nil && strings.HasPrefix(kind, "md_") {
+			fillMdMetric(kind, dfm.MdRaid, metric)
+		}
+		if dfm.Overlay != nil && dfm.Overlay.UpperSize != nil && strings.HasPrefix(kind, "overlay_") {
+			fillOverlayMetric(kind, dfm.Overlay, metric)
+		}
 	}
+	if metric.Data_ == nil {
+		return fmt.Errorf("Unknown metric %q of %s", kind, dfm.UnchangedMountPoint)
+	}
+	return nil
 }
 
 // createNamespace returns namespace slice of strings composed from: vendor, class, type and components of metric name
@@ -321,21 +780,108 @@ func (p *dfCollector) GetConfigPolicy() (*cpolicy.ConfigPolicy, error) {
 	node.Add(rule2)
 	rule3, _ := cpolicy.NewBoolRule(KeepOriginalMountPoint, false, true)
 	node.Add(rule3)
+	rule4, _ := cpolicy.NewStringRule(RefreshIntervals, false, "")
+	node.Add(rule4)
+	rule5, _ := cpolicy.NewStringRule(SysPath, false, "/sys")
+	node.Add(rule5)
+	rule6, _ := cpolicy.NewStringRule(CollapseLoopReadOnly, false, collapseLoopOff)
+	node.Add(rule6)
+	rule7, _ := cpolicy.NewStringRule(DevPath, false, "/dev")
+	node.Add(rule7)
+	rule8, _ := cpolicy.NewStringRule(NamespaceKey, false, namespaceKeyMountPoint)
+	node.Add(rule8)
+	rule9, _ := cpolicy.NewBoolRule(OverlayUpperSize, false, false)
+	node.Add(rule9)
+	rule10, _ := cpolicy.NewIntegerRule(OverlayWalkMaxFiles, false, dfltOverlayWalkMaxFiles)
+	rule10.SetMinimum(0)
+	node.Add(rule10)
+	rule11, _ := cpolicy.NewStringRule(Attribution, false, "")
+	node.Add(rule11)
+	rule12, _ := cpolicy.NewBoolRule(AttributionNames, false, false)
+	node.Add(rule12)
+	rule13, _ := cpolicy.NewStringRule(WatchedDirectories, false, "")
+	node.Add(rule13)
+	rule14, _ := cpolicy.NewIntegerRule(DirectoryMaxDepth, false, dfltDirectoryMaxDepth)
+	rule14.SetMinimum(0)
+	node.Add(rule14)
+	rule15, _ := cpolicy.NewIntegerRule(DirectoryMaxFiles, false, dfltDirectoryMaxFiles)
+	rule15.SetMinimum(0)
+	node.Add(rule15)
+	rule16, _ := cpolicy.NewStringRule(DirectoryTimeBudget, false, dfltDirectoryTimeBudget.String())
+	node.Add(rule16)
+	rule17, _ := cpolicy.NewIntegerRule(DirectoryTopChildren, false, dfltDirectoryTopChildren)
+	rule17.SetMinimum(0)
+	node.Add(rule17)
+	rule18, _ := cpolicy.NewBoolRule(DirectoryIncremental, false, false)
+	node.Add(rule18)
+	rule19, _ := cpolicy.NewIntegerRule(DirectoryCacheEntries, false, dfltDirectoryCacheMaxEntries)
+	rule19.SetMinimum(0)
+	node.Add(rule19)
+	rule20, _ := cpolicy.NewIntegerRule(DeletedOpenTop, false, dfltDeletedOpenTopProcesses)
+	rule20.SetMinimum(0)
+	node.Add(rule20)
+	rule21, _ := cpolicy.NewStringRule(ProcessScanInterval, false, dfltProcessScanInterval.String())
+	node.Add(rule21)
+	rule22, _ := cpolicy.NewIntegerRule(ProcessScanMax, false, dfltProcessScanMaxProcesses)
+	rule22.SetMinimum(0)
+	node.Add(rule22)
+	rule23, _ := cpolicy.NewIntegerRule(ProcessesUsingTop, false, 0)
+	rule23.SetMinimum(0)
+	node.Add(rule23)
+	rule24, _ := cpolicy.NewBoolRule(Quota, false, false)
+	node.Add(rule24)
+	rule25, _ := cpolicy.NewIntegerRule(QuotaTop, false, dfltQuotaTop)
+	rule25.SetMinimum(0)
+	node.Add(rule25)
+	rule26, _ := cpolicy.NewStringRule(MetricLayout, false, metricLayoutLegacy)
+	node.Add(rule26)
+	rule27, _ := cpolicy.NewStringRule(Deduplicate, false, deduplicateOff)
+	node.Add(rule27)
+	rule28, _ := cpolicy.NewStringRule(DeduplicatePrefer, false, preferShortest)
+	node.Add(rule28)
+	rule29, _ := cpolicy.NewStringRule(CatalogMode, false, catalogWildcard)
+	node.Add(rule29)
+	rule30, _ := cpolicy.NewStringRule(DirectoryCacheMaxAge, false, dfltDirectoryCacheMaxAge.String())
+	node.Add(rule30)
+	rule31, _ := cpolicy.NewStringRule(OverlayWalkInterval, false, dfltOverlayWalkInterval.String())
+	node.Add(rule31)
+	rule32, _ := cpolicy.NewStringRule(OverlayWalkTimeBudget, false, dfltOverlayWalkTimeBudget.String())
+	node.Add(rule32)
 	return cp, nil
 }
 
 // NewDfCollector creates new instance of plugin and returns pointer to initialized object.
 func NewDfCollector() *dfCollector {
 	logger := log.New()
-	imutex := new(sync.Mutex)
 	return &dfCollector{
-		stats:                    &dfStats{},
+		stats:                    &dfStats{cache: map[string]dfMetric{}},
 		logger:                   logger,
-		initializedMutex:         imutex,
+		configs:                  map[string]*dfCollector{},
+		configsMutex:             new(sync.Mutex),
 		proc_path:                procPath,
+		sys_path:                 sysPath,
+		dev_path:                 devPath,
 		excluded_fs_names:        dfltExcludedFSNames,
 		excluded_fs_types:        dfltExcludedFSTypes,
 		keep_original_mountpoint: true,
+		refresh_intervals:        refreshIntervals{},
+		collapse_loop_readonly:   collapseLoopOff,
+		namespace_key:            namespaceKeyMountPoint,
+		overlay_walker:           newOverlayWalker(dfltOverlayWalkInterval, dfltOverlayWalkMaxFiles, dfltOverlayWalkTimeBudget),
+		deleted_open_top:         dfltDeletedOpenTopProcesses,
+		process_scanner:          newProcessScanner(dfltProcessScanInterval, dfltProcessScanMaxProcesses),
+		quota_top:                dfltQuotaTop,
+		quota_reader:             quotactlReader{},
+		metric_layout:            metricLayoutLegacy,
+		deduplicate:              deduplicateOff,
+		deduplicate_prefer:       preferShortest,
+		directories: directoryOptions{
+			paths:       []string{},
+			maxDepth:    dfltDirectoryMaxDepth,
+			maxFiles:    dfltDirectoryMaxFiles,
+			timeBudget:  dfltDirectoryTimeBudget,
+			topChildren: dfltDirectoryTopChildren,
+		},
 	}
 }
 
@@ -353,33 +899,96 @@ func Meta() *plugin.PluginMeta {
 }
 
 type dfCollector struct {
-	initialized              bool
-	initializedMutex         *sync.Mutex
+	// settings compiled from configuration of tasks by hash of configuration
+	configs                  map[string]*dfCollector
+	configsMutex             *sync.Mutex
 	stats                    collector
 	logger                   *log.Logger
 	proc_path                string
+	sys_path                 string
+	dev_path                 string
 	excluded_fs_names        []string
 	excluded_fs_types        []string
 	keep_original_mountpoint bool
+	refresh_intervals        refreshIntervals
+	collapse_loop_readonly   string
+	namespace_key            string
+	overlay_upper_size       bool
+	overlay_walker           *overlayWalker
+	attributors              []attributor
+	directories              directoryOptions
+	dir_cache                *dirCache
+	deleted_open_top         int
+	process_scanner          *processScanner
+	processes_using_top      int
+	quota                    bool
+	quota_top                int
+	quota_reader             quotaReader
+	metric_layout            string
+	deduplicate              string
+	deduplicate_prefer       string
 }
 
 type dfMetric struct {
+	MountID                 string
 	Filesystem              string
+	MajorMinor              string
 	Used, Available, Blocks uint64
 	FsType                  string
 	MountPoint              string
 	UnchangedMountPoint     string
+	MountOptions            string
 	Inodes, IUsed, IFree    uint64
+	Remote                  bool
+	RemoteHost              string
+	RemoteExport            string
+	DeviceKernelName        string
+	DMName                  string
+	LVMVG, LVMLV            string
+	Crypt                   string
+	BackingDisks            []backingDisk
+	MdRaid                  *mdInfo
+	Loop                    *loopInfo
+	DiskIDs                 diskIDs
+	FSID                    string
+	MountRoot               string
+	Aliases                 []string
+	SuperOptions            string
+	Overlay                 *overlayInfo
+	DeletedOpen             *deletedOpen
+	Usage                   *mountUsage
+	Quotas                  []quotaEntry
+	// namespace key which replaced mount point in namespace
+	KeyedBy string
+	// tags added by attribution and metric layout stages
+	Attributes map[string]string
+	// Time of statfs call, kept when value is served from cache
+	Timestamp time.Time
+}
+
+// mountEntry is line of mountinfo split to fields, kept until it is known
+// which mounts are requested
+type mountEntry struct {
+	left, right []string
+	name        string
 }
 
 type collector interface {
-	collect(string, []string, []string, bool) ([]dfMetric, error)
+	collect(string, []string, []string, bool, refreshIntervals, *collectionPlan) ([]dfMetric, error)
 }
 
-type dfStats struct{}
+type dfStats struct {
+	// filesystem usage from previous collections by mount point
+	cache      map[string]dfMetric
+	cacheMutex sync.Mutex
+}
 
-func (dfs *dfStats) collect(procPath string, excluded_fs_names []string, excluded_fs_types []string, keep_original_mountpoint bool) ([]dfMetric, error) {
-	dfms := []dfMetric{}
+func (dfs *dfStats) collect(procPath string, excluded_fs_names []string, excluded_fs_types []string, keep_original_mountpoint bool, refresh_intervals refreshIntervals, plan *collectionPlan) ([]dfMetric, error) {
+	mounts := []mountEntry{}
+	dfs.cacheMutex.Lock()
+	defer dfs.cacheMutex.Unlock()
+	cache := map[string]dfMetric{}
+	now := time.Now()
 	cpath := path.Join(procPath, "1", MountInfoFile)
 	fh, err := os.Open(cpath)
 	if err != nil {
@@ -415,27 +1024,52 @@ func (dfs *dfStats) collect(procPath string, excluded_fs_names []string, exclude
 				leftFields[4], rightFields[0]))
 			continue
 		}
-		var dfm dfMetric
-		dfm.Filesystem = rightFields[1]
-		dfm.FsType = rightFields[0]
-		dfm.UnchangedMountPoint = leftFields[4]
-		if keep_original_mountpoint {
-			dfm.MountPoint = leftFields[4]
-		} else {
-			if leftFields[4] == "/" {
-				dfm.MountPoint = "rootfs"
-			} else {
-				dfm.MountPoint = strings.Replace(leftFields[4][1:], "/", "_", -1)
-				// Because there are mounted FS containing dots
-				// (like /etc/resolv.conf in Docker containers)
-				// and this is incompatible with Snap metric name policies
-				dfm.MountPoint = strings.Replace(dfm.MountPoint, ".", "_", -1)
+		mounts = append(mounts, mountEntry{
+			left:  leftFields,
+			right: rightFields,
+			name:  mountPointName(leftFields[4], keep_original_mountpoint),
+		})
+	}
+	// Mounts sharing name are collected together, so that they are
+	// disambiguated the same way as when all mounts are collected
+	wanted := map[string]bool{}
+	for _, m := range mounts {
+		if plan.wants(dfMetric{MountID: m.left[0], UnchangedMountPoint: m.left[4], MountPoint: m.name}) {
+			wanted[m.name] = true
+		}
+	}
+	dfms := []dfMetric{}
+	for _, m := range mounts {
+		if !wanted[m.name] {
+			// Keep cached usage of mounts not requested this time
+			if cached, ok := dfs.cache[m.left[4]]; ok {
+				cache[m.left[4]] = cached
 			}
+			continue
+		}
+		var dfm dfMetric
+		dfm.MountID = m.left[0]
+		dfm.Filesystem = m.right[1]
+		dfm.MajorMinor = m.left[2]
+		dfm.MountRoot = m.left[3]
+		dfm.FsType = m.right[0]
+		dfm.UnchangedMountPoint = m.left[4]
+		fillRemote(&dfm)
+		dfm.MountOptions = m.left[5]
+		dfm.SuperOptions = m.right[2]
+		dfm.MountPoint = m.name
+		if dfm.FsType == "overlay" {
+			dfm.Overlay = resolveOverlay(dfm.SuperOptions, mounts)
+		}
+		if dfs.fromCache(&dfm, refresh_intervals, now) {
+			cache[dfm.UnchangedMountPoint] = dfm
+			dfms = append(dfms, dfm)
+			continue
 		}
 		stat := syscall.Statfs_t{}
-		err := syscall.Statfs(leftFields[4], &stat)
+		err := syscall.Statfs(dfm.UnchangedMountPoint, &stat)
 		if err != nil {
-			log.Error(fmt.Sprintf("Error getting filesystem infos for %s", leftFields[4]))
+			log.Error(fmt.Sprintf("Error getting filesystem infos for %s", dfm.UnchangedMountPoint))
 			continue
 		}
 		// Blocks
@@ -443,15 +1077,35 @@ func (dfs *dfStats) collect(procPath string, excluded_fs_names []string, exclude
 		dfm.Available = (stat.Bavail * uint64(stat.Bsize)) / 1024
 		xFree := (stat.Bfree * uint64(stat.Bsize)) / 1024
 		dfm.Used = dfm.Blocks - xFree
+		dfm.FSID = formatFSID(stat.Fsid.X__val)
 		// Inodes
 		dfm.Inodes = stat.Files
 		dfm.IFree = stat.Ffree
 		dfm.IUsed = dfm.Inodes - dfm.IFree
+		dfm.Timestamp = now
+		cache[dfm.UnchangedMountPoint] = dfm
 		dfms = append(dfms, dfm)
 	}
+	// Forget filesystems which are not mounted anymore
+	dfs.cache = cache
 	return dfms, nil
 }
 
+// mountPointName returns name of mount point used in metric namespace
+func mountPointName(mountPoint string, keep_original_mountpoint bool) string {
+	if keep_original_mountpoint {
+		return mountPoint
+	}
+	if mountPoint == "/" {
+		return "rootfs"
+	}
+	name := strings.Replace(strings.TrimPrefix(mountPoint, "/"), "/", "_", -1)
+	// Because there are mounted FS containing dots
+	// (like /etc/resolv.conf in Docker containers)
+	// and this is incompatible with Snap metric name policies
+	return strings.Replace(name, ".", "_", -1)
+}
+
 // Return true if filesystem should not be taken into account
 func excludedFSFromList(fs string, excludeList []string) bool {
 	for _, v := range excludeList {
@@ -38,63 +38,69 @@ type DfPluginSuite struct {
 	suite.Suite
 	cfg           plugin.ConfigType
 	mockCollector *MockCollector
+	dfms          []dfMetric
 }
 
 func (dfp *DfPluginSuite) SetupSuite() {
 	dfms := []dfMetric{
 		dfMetric{
-			Blocks:     100,
-			Used:       50,
-			Available:  40,
-			FsType:     "ext4",
-			Filesystem: "/dev/sda1",
-			MountPoint: "rootfs",
-			Inodes:     1000,
-			IUsed:      500,
-			IFree:      400,
+			Blocks:              100,
+			Used:                50,
+			Available:           40,
+			FsType:              "ext4",
+			Filesystem:          "/dev/sda1",
+			MountPoint:          "rootfs",
+			UnchangedMountPoint: "/",
+			Inodes:              1000,
+			IUsed:               500,
+			IFree:               400,
 		},
 		dfMetric{
-			Blocks:     200,
-			Used:       110,
-			Available:  80,
-			FsType:     "ext4",
-			Filesystem: "/dev/sda2",
-			MountPoint: "big",
-			Inodes:     2000,
-			IUsed:      1000,
-			IFree:      800,
+			Blocks:              200,
+			Used:                110,
+			Available:           80,
+			FsType:              "ext4",
+			Filesystem:          "/dev/sda2",
+			MountPoint:          "big",
+			UnchangedMountPoint: "/big",
+			Inodes:              2000,
+			IUsed:               1000,
+			IFree:               800,
 		},
 	}
 	dfms_unchanged := []dfMetric{
 		dfMetric{
-			Blocks:     100,
-			Used:       50,
-			Available:  40,
-			FsType:     "ext4",
-			Filesystem: "/dev/sda1",
-			MountPoint: "/",
-			Inodes:     1000,
-			IUsed:      500,
-			IFree:      400,
+			Blocks:              100,
+			Used:                50,
+			Available:           40,
+			FsType:              "ext4",
+			Filesystem:          "/dev/sda1",
+			MountPoint:          "/",
+			UnchangedMountPoint: "/",
+			Inodes:              1000,
+			IUsed:               500,
+			IFree:               400,
 		},
 		dfMetric{
-			Blocks:     200,
-			Used:       110,
-			Available:  80,
-			FsType:     "ext4",
-			Filesystem: "/dev/sda2",
-			MountPoint: "/big",
-			Inodes:     2000,
-			IUsed:      1000,
-			IFree:      800,
+			Blocks:              200,
+			Used:                110,
+			Available:           80,
+			FsType:              "ext4",
+			Filesystem:          "/dev/sda2",
+			MountPoint:          "/big",
+			UnchangedMountPoint: "/big",
+			Inodes:              2000,
+			IUsed:               1000,
+			IFree:               800,
 		},
 	}
 	mc := &MockCollector{}
-	mc.On("collect", "/proc", dfltExcludedFSNames, dfltExcludedFSTypes, false).Return(dfms, nil)
-	mc.On("collect", "/dummy", dfltExcludedFSNames, dfltExcludedFSTypes, false).Return(dfms, errors.New("Fake error"))
-	mc.On("collect", "/proc", dfltExcludedFSNames, dfltExcludedFSTypes, true).Return(dfms_unchanged, nil)
-	mc.On("collect", "/dummy", dfltExcludedFSNames, dfltExcludedFSTypes, true).Return(dfms, errors.New("Fake error"))
+	mc.On("collect", "/proc", dfltExcludedFSNames, dfltExcludedFSTypes, false, refreshIntervals{}, mock.Anything).Return(dfms, nil)
+	mc.On("collect", "/dummy", dfltExcludedFSNames, dfltExcludedFSTypes, false, refreshIntervals{}, mock.Anything).Return(dfms, errors.New("Fake error"))
+	mc.On("collect", "/proc", dfltExcludedFSNames, dfltExcludedFSTypes, true, refreshIntervals{}, mock.Anything).Return(dfms_unchanged, nil)
+	mc.On("collect", "/dummy", dfltExcludedFSNames, dfltExcludedFSTypes, true, refreshIntervals{}, mock.Anything).Return(dfms, errors.New("Fake error"))
 	dfp.mockCollector = mc
+	dfp.dfms = dfms
 	dfp.cfg = plugin.ConfigType{}
 }
 
@@ -138,7 +144,7 @@ func (dfp *DfPluginSuite) TestGetMetricTypes() {
 				for _, m := range mts {
 					ns = append(ns, m.Namespace().String())
 				}
-				So(len(mts), ShouldEqual, 14)
+				So(len(mts), ShouldEqual, 64)
 				So(ns, ShouldContain, "/intel/procfs/filesystem/*/space_free")
 				So(ns, ShouldContain, "/intel/procfs/filesystem/*/space_reserved")
 				So(ns, ShouldContain, "/intel/procfs/filesystem/*/space_used")
@@ -153,6 +159,34 @@ func (dfp *DfPluginSuite) TestGetMetricTypes() {
 				So(ns, ShouldContain, "/intel/procfs/filesystem/*/inodes_percent_used")
 				So(ns, ShouldContain, "/intel/procfs/filesystem/*/device_name")
 				So(ns, ShouldContain, "/intel/procfs/filesystem/*/device_type")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/cache_age_seconds")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/md_level")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/md_devices_active")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/md_devices_failed")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/md_devices_spare")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/md_degraded")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/md_sync_action")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/md_sync_percent")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/md_sync_speed")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/overlay_upper_bytes")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/overlay_upper_inodes")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/space_deleted_open")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/open_files")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/processes_using")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/directory/*/dir_bytes")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/directory/*/dir_inodes")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/directory/*/dir_files")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/directory/*/largest/*/dir_bytes")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/directory/*/largest/*/dir_inodes")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/directory/*/largest/*/dir_files")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/quota/*/*/space_used")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/quota/*/*/space_soft_limit")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/quota/*/*/space_hard_limit")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/quota/*/*/space_grace_seconds")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/quota/*/*/inodes_used")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/quota/*/*/inodes_soft_limit")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/quota/*/*/inodes_hard_limit")
+				So(ns, ShouldContain, "/intel/procfs/filesystem/*/quota/*/*/inodes_grace_seconds")
 			})
 		})
 	})
@@ -163,6 +197,71 @@ func (dfp *DfPluginSuite) TestCollectMetrics() {
 		dfPlg := NewDfCollector()
 		dfPlg.stats = dfp.mockCollector
 
+		Convey("When concrete catalog of metrics is requested", func() {
+			node := cdata.NewNode()
+			node.AddItem(KeepOriginalMountPoint, ctypes.ConfigValueBool{Value: false})
+			node.AddItem(CatalogMode, ctypes.ConfigValueStr{Value: catalogConcrete})
+			mts, err := dfPlg.GetMetricTypes(plugin.ConfigType{ConfigDataNode: node})
+
+			Convey("Then metrics of mounted filesystems are returned", func() {
+				So(err, ShouldBeNil)
+				So(len(mts), ShouldEqual, 72)
+				ns := map[string]plugin.MetricType{}
+				for _, m := range mts {
+					ns[m.Namespace().String()] = m
+				}
+				So(ns, ShouldContainKey, "/intel/procfs/filesystem/rootfs/space_free")
+				So(ns, ShouldContainKey, "/intel/procfs/filesystem/big/open_files")
+				So(ns, ShouldNotContainKey, "/intel/procfs/filesystem/*/space_free")
+				So(ns["/intel/procfs/filesystem/big/space_used"].Description(), ShouldContainSubstring, "/dev/sda2 (ext4)")
+				So(ns["/intel/procfs/filesystem/big/space_used"].Unit(), ShouldEqual, "KB")
+				So(ns["/intel/procfs/filesystem/big/space_percent_used"].Unit(), ShouldEqual, "%")
+			})
+
+			Convey("Then configuration of collection is not changed", func() {
+				So(dfPlg.keep_original_mountpoint, ShouldBeTrue)
+			})
+		})
+
+		Convey("When metric of concrete catalog is collected with default configuration", func() {
+			node := cdata.NewNode()
+			node.AddItem(CatalogMode, ctypes.ConfigValueStr{Value: catalogConcrete})
+			mts, err := dfPlg.GetMetricTypes(plugin.ConfigType{ConfigDataNode: node})
+			So(err, ShouldBeNil)
+			requested := []plugin.MetricType{}
+			for _, m := range mts {
+				if m.Namespace()[3].Value == "/big" && m.Namespace()[4].Value == "space_free" {
+					requested = append(requested, plugin.MetricType{Namespace_: m.Namespace()})
+				}
+			}
+			So(len(requested), ShouldEqual, 1)
+			metrics, err := dfPlg.CollectMetrics(requested)
+
+			Convey("Then metric is returned under name listed in catalog", func() {
+				So(err, ShouldBeNil)
+				So(len(metrics), ShouldEqual, 1)
+				So(metrics[0].Namespace().Strings(), ShouldResemble, requested[0].Namespace().Strings())
+				So(metrics[0].Data(), ShouldEqual, 80)
+			})
+		})
+
+		Convey("When both catalogs of metrics are requested", func() {
+			node := cdata.NewNode()
+			node.AddItem(KeepOriginalMountPoint, ctypes.ConfigValueBool{Value: false})
+			node.AddItem(CatalogMode, ctypes.ConfigValueStr{Value: catalogBoth})
+			mts, err := dfPlg.GetMetricTypes(plugin.ConfigType{ConfigDataNode: node})
+			So(err, ShouldBeNil)
+			So(len(mts), ShouldEqual, 100)
+		})
+
+		Convey("When catalog of metrics is requested with wrong mode", func() {
+			node := cdata.NewNode()
+			node.AddItem(CatalogMode, ctypes.ConfigValueStr{Value: "all"})
+			_, err := dfPlg.GetMetricTypes(plugin.ConfigType{ConfigDataNode: node})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, CatalogMode)
+		})
+
 		Convey("When list of metrics is requested with too short namespace", func() {
 			mts := []plugin.MetricType{
 				plugin.MetricType{
@@ -193,7 +292,104 @@ func (dfp *DfPluginSuite) TestCollectMetrics() {
 			})
 		})
 
+		Convey("When metrics of tasks with different configuration are requested", func() {
+			sanitized := cdata.NewNode()
+			sanitized.AddItem(KeepOriginalMountPoint, ctypes.ConfigValueBool{Value: false})
+			original := cdata.NewNode()
+			original.AddItem(KeepOriginalMountPoint, ctypes.ConfigValueBool{Value: true})
+			mts := []plugin.MetricType{
+				plugin.MetricType{
+					Namespace_: core.NewNamespace("intel", "procfs", "filesystem", "*", "space_free"),
+					Config_:    sanitized,
+				},
+				plugin.MetricType{
+					Namespace_: core.NewNamespace("intel", "procfs", "filesystem", "*", "space_free"),
+					Config_:    original,
+				},
+			}
+			metrics, err := dfPlg.CollectMetrics(mts)
+
+			Convey("Then each request is collected with its own configuration", func() {
+				So(err, ShouldBeNil)
+				stats := []string{}
+				for _, m := range metrics {
+					stats = append(stats, strings.Join(m.Namespace().Strings()[3:], "/"))
+				}
+				So(stats, ShouldResemble, []string{"rootfs/space_free", "big/space_free", "//space_free", "/big/space_free"})
+			})
+		})
+
+		Convey("When metrics are selected with glob patterns and tuples", func() {
+			node := cdata.NewNode()
+			node.AddItem(KeepOriginalMountPoint, ctypes.ConfigValueBool{Value: false})
+			mts := []plugin.MetricType{
+				plugin.MetricType{
+					Namespace_: core.NewNamespace("intel", "procfs", "filesystem", "b*", "space_percent_*"),
+					Config_:    node,
+				},
+				plugin.MetricType{
+					Namespace_: core.NewNamespace("intel", "procfs", "filesystem", "(rootfs;big)", "(space_free;inodes_free)"),
+					Config_:    node,
+				},
+			}
+			metrics, err := dfPlg.CollectMetrics(mts)
+
+			Convey("Then only matching metrics are returned", func() {
+				So(err, ShouldBeNil)
+				stats := []string{}
+				for _, m := range metrics {
+					stats = append(stats, strings.Join(m.Namespace().Strings()[3:], "/"))
+				}
+				So(len(stats), ShouldEqual, 7)
+				So(stats, ShouldContain, "big/space_percent_used")
+				So(stats, ShouldNotContain, "rootfs/space_percent_used")
+				So(stats, ShouldContain, "rootfs/inodes_free")
+				So(stats, ShouldContain, "big/space_free")
+			})
+		})
+
+		Convey("When unknown metric is requested", func() {
+			mts := []plugin.MetricType{
+				plugin.MetricType{
+					Namespace_: core.NewNamespace("intel", "procfs", "filesystem", "rootfs", "space_avail"),
+				},
+			}
+			metrics, err := dfPlg.CollectMetrics(mts)
+
+			Convey("Then error should be reported", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "Unknown metric \"space_avail\"")
+				So(metrics, ShouldBeNil)
+			})
+		})
+
+		Convey("When unknown metric of quota, aggregate or directory is requested", func() {
+			for _, ns := range []core.Namespace{
+				core.NewNamespace("intel", "procfs", "filesystem", "rootfs", "quota", "user", "*", "space_avail"),
+				core.NewNamespace("intel", "procfs", "filesystem", "_total", "space_avail"),
+				core.NewNamespace("intel", "procfs", "filesystem", "_by_type", "ext4", "(space_free;space_avail)"),
+				core.NewNamespace("intel", "procfs", "filesystem", "directory", "*", "dir_size"),
+				core.NewNamespace("intel", "procfs", "filesystem", "directory", "*", "largest", "*", "dir_size"),
+			} {
+				metrics, err := dfPlg.CollectMetrics([]plugin.MetricType{plugin.MetricType{Namespace_: ns}})
+
+				Convey("Then error should be reported for "+ns.String(), func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "Unknown metric")
+					So(metrics, ShouldBeNil)
+				})
+			}
+		})
+
 		Convey("When list of specific metrics is requested", func() {
+			// only requested mounts are planned to be collected
+			literal := &MockCollector{}
+			literal.On("collect", "/proc", dfltExcludedFSNames, dfltExcludedFSTypes, false, refreshIntervals{},
+				mock.MatchedBy(func(plan *collectionPlan) bool {
+					return !plan.all && len(plan.mounts) == 2 && plan.mounts["rootfs"] && plan.mounts["big"] &&
+						len(plan.patterns) == 0
+				})).Return(dfp.dfms, nil)
+			dfPlg.stats = literal
 
 			node := cdata.NewNode()
 			node.AddItem(KeepOriginalMountPoint, ctypes.ConfigValueBool{Value: false})
@@ -230,9 +426,21 @@ func (dfp *DfPluginSuite) TestCollectMetrics() {
 				So(ok, ShouldBeTrue)
 				So(val, ShouldNotBeNil)
 			})
+
+			Convey("Then only requested mounts are collected", func() {
+				literal.AssertExpectations(dfp.T())
+			})
 		})
 
 		Convey("When one single available dynamic metrics is requested", func() {
+			// wildcard requires every mount to be collected
+			wildcard := &MockCollector{}
+			wildcard.On("collect", "/proc", dfltExcludedFSNames, dfltExcludedFSTypes, false, refreshIntervals{},
+				mock.MatchedBy(func(plan *collectionPlan) bool {
+					return plan.all && plan.requested("space_free") && !plan.requested("space_deleted_open")
+				})).Return(dfp.dfms, nil)
+			dfPlg.stats = wildcard
+
 			node := cdata.NewNode()
 			node.AddItem(KeepOriginalMountPoint, ctypes.ConfigValueBool{Value: false})
 			mts := []plugin.MetricType{
@@ -265,6 +473,34 @@ func (dfp *DfPluginSuite) TestCollectMetrics() {
 				So(ok, ShouldBeTrue)
 				So(val, ShouldNotBeNil)
 			})
+
+			Convey("Then all mounts are collected", func() {
+				wildcard.AssertExpectations(dfp.T())
+			})
+		})
+
+		Convey("When metrics are requested with tags layout", func() {
+			node := cdata.NewNode()
+			node.AddItem(KeepOriginalMountPoint, ctypes.ConfigValueBool{Value: true})
+			node.AddItem(MetricLayout, ctypes.ConfigValueStr{Value: metricLayoutTags})
+			mts := []plugin.MetricType{
+				plugin.MetricType{
+					Namespace_: core.NewNamespace("intel", "procfs", "filesystem", "*", "space_free"),
+					Config_:    node,
+				},
+			}
+			metrics, err := dfPlg.CollectMetrics(mts)
+
+			Convey("Then sanitized mount points are used in namespace", func() {
+				So(err, ShouldBeNil)
+				So(len(metrics), ShouldEqual, 2)
+				So(metrics[0].Namespace().Strings()[3], ShouldEqual, "rootfs")
+			})
+
+			Convey("Then filesystem is described by tags", func() {
+				So(metrics[1].Tags()["device"], ShouldEqual, "/dev/sda2")
+				So(metrics[1].Tags()["fs_type"], ShouldEqual, "ext4")
+			})
 		})
 
 		Convey("When all available dynamic metrics are requested for given mountpoint", func() {
@@ -290,7 +526,7 @@ func (dfp *DfPluginSuite) TestCollectMetrics() {
 					So(stat, ShouldStartWith, "rootfs")
 					metvals[stat] = m.Data()
 				}
-				So(len(metrics), ShouldEqual, 14)
+				So(len(metrics), ShouldEqual, 18)
 
 				val, ok := metvals["rootfs/space_free"]
 				So(ok, ShouldBeTrue)
@@ -321,7 +557,7 @@ func (dfp *DfPluginSuite) TestCollectMetrics() {
 					metvals[stat] = m.Data()
 				}
 
-				So(len(metrics), ShouldEqual, 28)
+				So(len(metrics), ShouldEqual, 36)
 
 				val, ok := metvals["rootfs/space_free"]
 				So(ok, ShouldBeTrue)
@@ -356,7 +592,7 @@ func (dfp *DfPluginSuite) TestCollectMetrics() {
 					metvals[stat] = m.Data()
 				}
 
-				So(len(metrics), ShouldEqual, 28)
+				So(len(metrics), ShouldEqual, 36)
 
 				val, ok := metvals["rootfs/space_free"]
 				So(ok, ShouldBeTrue)
@@ -397,7 +633,7 @@ func (dfp *DfPluginSuite) TestCollect() {
 		dfPlg := NewDfCollector()
 
 		Convey("When called with non existing path", func() {
-			metrics, err := dfPlg.stats.collect("/dummy", []string{}, []string{}, false)
+			metrics, err := dfPlg.stats.collect("/dummy", []string{}, []string{}, false, refreshIntervals{}, nil)
 			Convey("Then error should be reported", func() {
 				So(err, ShouldNotBeNil)
 				So(err.Error(), ShouldContainSubstring, "no such file or directory")
@@ -406,7 +642,7 @@ func (dfp *DfPluginSuite) TestCollect() {
 		})
 
 		Convey("When called with existing path and different exclusion lists", func() {
-			metrics, err := dfPlg.stats.collect("/proc", []string{"dummy"}, []string{"dummy"}, false)
+			metrics, err := dfPlg.stats.collect("/proc", []string{"dummy"}, []string{"dummy"}, false, refreshIntervals{}, nil)
 			Convey("Then no error should be reported with dummy exclusion lists", func() {
 				So(err, ShouldBeNil)
 				So(metrics, ShouldNotBeNil)
@@ -423,7 +659,7 @@ func (dfp *DfPluginSuite) TestCollect() {
 				So(exclusions, ShouldEqual, true)
 			})
 
-			metrics, err = dfPlg.stats.collect("/proc", dfltExcludedFSNames, dfltExcludedFSTypes, false)
+			metrics, err = dfPlg.stats.collect("/proc", dfltExcludedFSNames, dfltExcludedFSTypes, false, refreshIntervals{}, nil)
 			Convey("Then error should be reported", func() {
 				So(err, ShouldBeNil)
 				So(metrics, ShouldNotBeNil)
@@ -439,7 +675,7 @@ func (dfp *DfPluginSuite) TestCollect() {
 		})
 
 		Convey("When called with existing path keeping original mount points", func() {
-			metrics, err := dfPlg.stats.collect("/proc", dfltExcludedFSNames, dfltExcludedFSTypes, true)
+			metrics, err := dfPlg.stats.collect("/proc", dfltExcludedFSNames, dfltExcludedFSTypes, true, refreshIntervals{}, nil)
 			Convey("Then error should be reported", func() {
 				So(err, ShouldBeNil)
 				So(metrics, ShouldNotBeNil)
@@ -650,7 +886,7 @@ type MockCollector struct {
 	mock.Mock
 }
 
-func (mc *MockCollector) collect(p string, n []string, f []string, b bool) ([]dfMetric, error) {
-	ret := mc.Mock.Called(p, n, f, b)
+func (mc *MockCollector) collect(p string, n []string, f []string, b bool, r refreshIntervals, plan *collectionPlan) ([]dfMetric, error) {
+	ret := mc.Mock.Called(p, n, f, b, r, plan)
 	return ret.Get(0).([]dfMetric), ret.Error(1)
 }
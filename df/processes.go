@@ -0,0 +1,216 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	dfltProcessScanInterval     = 30 * time.Second
+	dfltProcessScanMaxProcesses = 10000
+)
+
+// procHandles holds number of files of filesystem used by process
+type procHandles struct {
+	PID     int
+	Comm    string
+	Handles uint64
+}
+
+// mountUsage describes processes using filesystem
+type mountUsage struct {
+	// open descriptors and distinct memory mapped files
+	OpenFiles uint64
+	// processes having open files, working or root directory on filesystem
+	Processes uint64
+	// processes with the most open files, sorted by number of files
+	Top []procHandles
+}
+
+// procHandlesByCount sorts processes from the one with the most open files
+type procHandlesByCount []procHandles
+
+func (p procHandlesByCount) Len() int { return len(p) }
+func (p procHandlesByCount) Less(i, j int) bool {
+	if p[i].Handles != p[j].Handles {
+		return p[i].Handles > p[j].Handles
+	}
+	return p[i].PID < p[j].PID
+}
+func (p procHandlesByCount) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+// processScanner scans processes for used filesystems, results are reused
+// until interval elapses and at most maxProcesses processes are scanned
+type processScanner struct {
+	mutex        sync.Mutex
+	interval     time.Duration
+	maxProcesses int
+	last         time.Time
+	usage        map[string]*mountUsage
+	// result of scan of deleted but open files, done only when requested
+	deletedLast time.Time
+	deleted     map[string]*deletedOpen
+}
+
+func newProcessScanner(interval time.Duration, maxProcesses int) *processScanner {
+	return &processScanner{interval: interval, maxProcesses: maxProcesses}
+}
+
+// Return major:minor of device holding file, link is followed
+func fileDevice(file string) (string, bool) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(file, &st); err != nil {
+		return "", false
+	}
+	return majorMinor(uint64(st.Dev)), true
+}
+
+// parseMapsDevice converts device of /proc/<pid>/maps (hex major:minor) to mountinfo notation
+func parseMapsDevice(dev string) (string, bool) {
+	parts := strings.Split(dev, ":")
+	if len(parts) != 2 {
+		return "", false
+	}
+	major, err1 := strconv.ParseUint(parts[0], 16, 32)
+	minor, err2 := strconv.ParseUint(parts[1], 16, 32)
+	if err1 != nil || err2 != nil {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d", major, minor), true
+}
+
+// scanProcess returns number of open files of process by major:minor of device,
+// devices holding working or root directory of process are included with no files
+func scanProcess(procPath string, pid int) map[string]uint64 {
+	files := map[string]uint64{}
+	pidPath := path.Join(procPath, strconv.Itoa(pid))
+	if fh, err := os.Open(path.Join(pidPath, "fd")); err == nil {
+		fds, _ := fh.Readdirnames(-1)
+		fh.Close()
+		for _, fd := range fds {
+			if majmin, ok := fileDevice(path.Join(pidPath, "fd", fd)); ok {
+				files[majmin]++
+			}
+		}
+	}
+	for _, link := range []string{"cwd", "root"} {
+		if majmin, ok := fileDevice(path.Join(pidPath, link)); ok {
+			files[majmin] += 0
+		}
+	}
+	fh, err := os.Open(path.Join(pidPath, "maps"))
+	if err != nil {
+		return files
+	}
+	defer fh.Close()
+	// 7f2c4a1e0000-7f2c4a202000 r--p 00000000 08:01 1835265  /usr/lib/libc.so.6
+	mapped := map[string]bool{}
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[4] == "0" || mapped[fields[3]+" "+fields[4]] {
+			continue
+		}
+		mapped[fields[3]+" "+fields[4]] = true
+		if majmin, ok := parseMapsDevice(fields[3]); ok {
+			files[majmin]++
+		}
+	}
+	return files
+}
+
+// scan returns usage of filesystems by major:minor of device,
+// previous result is returned if scan interval has not elapsed
+func (ps *processScanner) scan(procPath string) map[string]*mountUsage {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	if ps.usage != nil && time.Since(ps.last) < ps.interval {
+		return ps.usage
+	}
+	usage := map[string]*mountUsage{}
+	pids := listPIDs(procPath)
+	if ps.maxProcesses > 0 && len(pids) > ps.maxProcesses {
+		log.Debug(fmt.Sprintf("Scanning only %d of %d processes", ps.maxProcesses, len(pids)))
+		pids = pids[:ps.maxProcesses]
+	}
+	for _, pid := range pids {
+		files := scanProcess(procPath, pid)
+		if len(files) == 0 {
+			continue
+		}
+		comm := processComm(procPath, pid)
+		for majmin, count := range files {
+			if usage[majmin] == nil {
+				usage[majmin] = &mountUsage{}
+			}
+			usage[majmin].OpenFiles += count
+			usage[majmin].Processes++
+			usage[majmin].Top = append(usage[majmin].Top, procHandles{PID: pid, Comm: comm, Handles: count})
+		}
+	}
+	for _, mu := range usage {
+		sort.Sort(procHandlesByCount(mu.Top))
+	}
+	ps.usage = usage
+	ps.last = time.Now()
+	return usage
+}
+
+// Function to fill usage of filesystems by processes,
+// only top processes with the most open files are kept
+func fillMountUsage(scanner *processScanner, procPath string, dfms []dfMetric, top int) {
+	usage := scanner.scan(procPath)
+	for i := range dfms {
+		mu := &mountUsage{}
+		if found, ok := usage[dfms[i].MajorMinor]; ok {
+			mu.OpenFiles = found.OpenFiles
+			mu.Processes = found.Processes
+			mu.Top = found.Top
+			if len(mu.Top) > top {
+				mu.Top = mu.Top[:top]
+			}
+		}
+		dfms[i].Usage = mu
+	}
+}
+
+// usingProcessesTag returns processes using filesystem as comma separated
+// list of <pid>:<comm>:<open files>
+func usingProcessesTag(mu *mountUsage) string {
+	procs := []string{}
+	for _, proc := range mu.Top {
+		procs = append(procs, fmt.Sprintf("%d:%s:%d", proc.PID, proc.Comm, proc.Handles))
+	}
+	return strings.Join(procs, ",")
+}
@@ -0,0 +1,115 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testMaps = `00400000-00452000 r-xp 00000000 08:01 1835265    /usr/bin/app
+00651000-00652000 rw-p 00051000 08:01 1835265    /usr/bin/app
+7f2c4a1e0000-7f2c4a202000 r--p 00000000 fd:00 262147     /usr/lib/libc.so.6
+7ffd1a9c5000-7ffd1a9e6000 rw-p 00000000 00:00 0          [stack]
+`
+
+func TestMountUsage(t *testing.T) {
+	Convey("Given processes using filesystems", t, func() {
+		root, _ := ioutil.TempDir("", "df-processes")
+		defer os.RemoveAll(root)
+		procPath := filepath.Join(root, "proc")
+		data := filepath.Join(root, "data")
+		makeTree(data, map[string]int{"a.db": 1024, "b.db": 1024})
+		addOpenFile(procPath, "100", "3", filepath.Join(data, "a.db"))
+		addOpenFile(procPath, "100", "4", filepath.Join(data, "b.db"))
+		ioutil.WriteFile(filepath.Join(procPath, "100", "comm"), []byte("db\n"), 0644)
+		ioutil.WriteFile(filepath.Join(procPath, "100", "maps"), []byte(testMaps), 0644)
+		os.MkdirAll(filepath.Join(procPath, "200"), 0755)
+		os.Symlink(data, filepath.Join(procPath, "200", "cwd"))
+		ioutil.WriteFile(filepath.Join(procPath, "200", "comm"), []byte("sh\n"), 0644)
+
+		var st syscall.Stat_t
+		syscall.Stat(data, &st)
+		majmin := majorMinor(uint64(st.Dev))
+		dfms := []dfMetric{
+			{MountPoint: "data", MajorMinor: majmin},
+			{MountPoint: "root", MajorMinor: "8:1"},
+			{MountPoint: "lvm", MajorMinor: "253:0"},
+			{MountPoint: "other", MajorMinor: "8:2"},
+		}
+		scanner := newProcessScanner(time.Hour, 0)
+
+		Convey("When usage of filesystems is filled", func() {
+			fillMountUsage(scanner, procPath, dfms, 2)
+
+			Convey("Then open files and processes are counted", func() {
+				So(dfms[0].Usage.OpenFiles, ShouldEqual, 2)
+				So(dfms[0].Usage.Processes, ShouldEqual, 2)
+				So(usingProcessesTag(dfms[0].Usage), ShouldEqual, "100:db:2,200:sh:0")
+			})
+
+			Convey("Then memory mapped files are counted once", func() {
+				So(dfms[1].Usage.OpenFiles, ShouldEqual, 1)
+				So(dfms[1].Usage.Processes, ShouldEqual, 1)
+				So(dfms[2].Usage.OpenFiles, ShouldEqual, 1)
+			})
+
+			Convey("Then unused filesystem is reported", func() {
+				So(dfms[3].Usage, ShouldResemble, &mountUsage{})
+				_, ok := createTags(dfms[3])["using_processes"]
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When processes are scanned again within interval", func() {
+			fillMountUsage(scanner, procPath, dfms, 0)
+			addOpenFile(procPath, "300", "3", filepath.Join(data, "a.db"))
+			fillMountUsage(scanner, procPath, dfms, 0)
+
+			Convey("Then previous result is reported", func() {
+				So(dfms[0].Usage.Processes, ShouldEqual, 2)
+				So(dfms[0].Usage.Top, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When number of scanned processes is limited", func() {
+			fillMountUsage(newProcessScanner(0, 1), procPath, dfms, 0)
+
+			Convey("Then only first processes are scanned", func() {
+				So(dfms[0].Usage.Processes, ShouldEqual, 1)
+				So(dfms[0].Usage.OpenFiles, ShouldEqual, 2)
+			})
+		})
+	})
+
+	Convey("Given device of memory mapping", t, func() {
+		majmin, ok := parseMapsDevice("fd:0a")
+		So(ok, ShouldBeTrue)
+		So(majmin, ShouldEqual, "253:10")
+		_, ok = parseMapsDevice("fd")
+		So(ok, ShouldBeFalse)
+	})
+}
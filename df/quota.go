@@ -0,0 +1,299 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/intelsdi-x/snap/control/plugin"
+	"github.com/intelsdi-x/snap/core"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// namespace element preceding quotas of filesystem
+	nsQuota = "quota"
+
+	// quota types of quotactl
+	usrQuota = 0
+	grpQuota = 1
+	prjQuota = 2
+
+	// Q_GETNEXTQUOTA command of quotactl (Linux 4.6+)
+	qGetNextQuota = 0x800009
+	// size of block in quota limits, the same as unit of reported space
+	quotaBlockSize = 1024
+)
+
+var (
+	quotaMetricsKind = []string{
+		"space_used",
+		"space_soft_limit",
+		"space_hard_limit",
+		"space_grace_seconds",
+		"inodes_used",
+		"inodes_soft_limit",
+		"inodes_hard_limit",
+		"inodes_grace_seconds",
+	}
+	dfltQuotaTop = 10
+	// names of quota types used in namespace
+	quotaTypeNames = map[int]string{
+		usrQuota: "user",
+		grpQuota: "group",
+		prjQuota: "project",
+	}
+	// mount options enabling quota of given type, options ending with "="
+	// are prefixes (eg. usrjquota=aquota.user)
+	quotaOptions = map[int][]string{
+		usrQuota: {"usrquota", "quota", "uquota", "uqnoenforce", "qnoenforce", "usrjquota="},
+		grpQuota: {"grpquota", "gquota", "gqnoenforce", "grpjquota="},
+		prjQuota: {"prjquota", "pquota", "pqnoenforce"},
+	}
+)
+
+// quotaEntry holds usage and limits of single user, group or project
+type quotaEntry struct {
+	Type string
+	ID   uint32
+	// space in KB, the same unit as filesystem metrics
+	SpaceUsed, SpaceSoft, SpaceHard    uint64
+	InodesUsed, InodesSoft, InodesHard uint64
+	// time when grace period expires, zero if soft limit is not exceeded
+	SpaceGrace, InodesGrace time.Time
+}
+
+// quotasBySpace sorts quotas from the one using the most space
+type quotasBySpace []quotaEntry
+
+func (q quotasBySpace) Len() int { return len(q) }
+func (q quotasBySpace) Less(i, j int) bool {
+	if q[i].SpaceUsed != q[j].SpaceUsed {
+		return q[i].SpaceUsed > q[j].SpaceUsed
+	}
+	return q[i].ID < q[j].ID
+}
+func (q quotasBySpace) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+// quotaReader reads quotas of filesystem placed on device
+type quotaReader interface {
+	readQuotas(device string, quotaType int) ([]quotaEntry, error)
+}
+
+// quotactlReader reads quotas using quotactl syscall
+type quotactlReader struct{}
+
+// nextDqBlk is struct if_nextdqblk of quotactl
+type nextDqBlk struct {
+	bHardLimit uint64
+	bSoftLimit uint64
+	curSpace   uint64
+	iHardLimit uint64
+	iSoftLimit uint64
+	curInodes  uint64
+	bTime      uint64
+	iTime      uint64
+	valid      uint32
+	id         uint32
+}
+
+// graceTime converts expiry of grace period to time
+func graceTime(t uint64) time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(t), 0)
+}
+
+func (quotactlReader) readQuotas(device string, quotaType int) ([]quotaEntry, error) {
+	special, err := syscall.BytePtrFromString(device)
+	if err != nil {
+		return nil, err
+	}
+	cmd := qGetNextQuota<<8 | quotaType&0xff
+	entries := []quotaEntry{}
+	for id := uint32(0); ; {
+		var dq nextDqBlk
+		_, _, errno := syscall.Syscall6(syscall.SYS_QUOTACTL, uintptr(cmd),
+			uintptr(unsafe.Pointer(special)), uintptr(id), uintptr(unsafe.Pointer(&dq)), 0, 0)
+		if errno == syscall.ENOENT {
+			break
+		}
+		if errno != 0 {
+			return nil, errno
+		}
+		entries = append(entries, quotaEntry{
+			ID:          dq.id,
+			SpaceUsed:   dq.curSpace / quotaBlockSize,
+			SpaceSoft:   dq.bSoftLimit,
+			SpaceHard:   dq.bHardLimit,
+			InodesUsed:  dq.curInodes,
+			InodesSoft:  dq.iSoftLimit,
+			InodesHard:  dq.iHardLimit,
+			SpaceGrace:  graceTime(dq.bTime),
+			InodesGrace: graceTime(dq.iTime),
+		})
+		if dq.id == ^uint32(0) {
+			break
+		}
+		id = dq.id + 1
+	}
+	return entries, nil
+}
+
+// quotaTypes returns quota types enabled by mount options
+func quotaTypes(options ...string) []int {
+	types := []int{}
+	for _, qtype := range []int{usrQuota, grpQuota, prjQuota} {
+		enabled := false
+		for _, opts := range options {
+			for _, option := range strings.Split(opts, ",") {
+				for _, name := range quotaOptions[qtype] {
+					if option == name || strings.HasSuffix(name, "=") && strings.HasPrefix(option, name) {
+						enabled = true
+					}
+				}
+			}
+		}
+		if enabled {
+			types = append(types, qtype)
+		}
+	}
+	return types
+}
+
+// Function to fill quotas of filesystems mounted with quota options,
+// only top quotas using the most space are kept for each type when top is positive
+func fillQuotas(reader quotaReader, dfms []dfMetric, top int) {
+	read := map[string][]quotaEntry{}
+	for i := range dfms {
+		for _, qtype := range quotaTypes(dfms[i].MountOptions, dfms[i].SuperOptions) {
+			// bind mounts of filesystem share quotas
+			key := dfms[i].Filesystem + "\x00" + strconv.Itoa(qtype)
+			entries, ok := read[key]
+			if !ok {
+				var err error
+				entries, err = reader.readQuotas(dfms[i].Filesystem, qtype)
+				if err != nil {
+					log.Debug(fmt.Sprintf("Error getting %s quotas of %s: %s", quotaTypeNames[qtype], dfms[i].Filesystem, err))
+				}
+				sort.Sort(quotasBySpace(entries))
+				if top > 0 && len(entries) > top {
+					entries = entries[:top]
+				}
+				for j := range entries {
+					entries[j].Type = quotaTypeNames[qtype]
+				}
+				read[key] = entries
+			}
+			dfms[i].Quotas = append(dfms[i].Quotas, entries...)
+		}
+	}
+}
+
+// Return true if namespace requests quotas:
+// /intel/procfs/filesystem/<mount_point>/quota/<quota_type>/<quota_id>/<metric>
+func isQuotaNamespace(ns core.Namespace) bool {
+	return len(ns) == 8 && ns[len(namespacePrefix)+1].Value == nsQuota && !isDirectoryNamespace(ns)
+}
+
+// quotaMetricTypes returns metric types of quotas
+func quotaMetricTypes() []plugin.MetricType {
+	mts := []plugin.MetricType{}
+	for _, kind := range quotaMetricsKind {
+		mts = append(mts, plugin.MetricType{
+			Namespace_: core.NewNamespace(namespacePrefix...).
+				AddDynamicElement(nsType, "name of filesystem").
+				AddStaticElement(nsQuota).
+				AddDynamicElement("quota_type", "type of quota: user, group or project").
+				AddDynamicElement("quota_id", "user, group or project ID").
+				AddStaticElement(kind),
+			Description_: "quota metric: " + kind,
+		})
+	}
+	return mts
+}
+
+// graceRemaining returns seconds remaining until grace period expires
+func graceRemaining(grace time.Time, now time.Time) float64 {
+	if grace.IsZero() || grace.Before(now) {
+		return 0.0
+	}
+	return grace.Sub(now).Seconds()
+}
+
+// Function to fill metric with quota usage or limit
+func fillQuotaMetric(kind string, q quotaEntry, now time.Time, metric *plugin.MetricType) {
+	switch kind {
+	case "space_used":
+		metric.Data_ = q.SpaceUsed
+	case "space_soft_limit":
+		metric.Data_ = q.SpaceSoft
+	case "space_hard_limit":
+		metric.Data_ = q.SpaceHard
+	case "space_grace_seconds":
+		metric.Data_ = graceRemaining(q.SpaceGrace, now)
+	case "inodes_used":
+		metric.Data_ = q.InodesUsed
+	case "inodes_soft_limit":
+		metric.Data_ = q.InodesSoft
+	case "inodes_hard_limit":
+		metric.Data_ = q.InodesHard
+	case "inodes_grace_seconds":
+		metric.Data_ = graceRemaining(q.InodesGrace, now)
+	}
+}
+
+// quotaMetrics returns quota metrics of filesystems matching namespace
+func quotaMetrics(ns core.Namespace, dfms []dfMetric, curTime time.Time) []plugin.MetricType {
+	metrics := []plugin.MetricType{}
+	elts := ns.Strings()[len(namespacePrefix):]
+	for _, dfm := range dfms {
+		if !matchElement(elts[0], dfm.MountPoint) {
+			continue
+		}
+		for _, q := range dfm.Quotas {
+			id := strconv.FormatUint(uint64(q.ID), 10)
+			if !matchElement(elts[2], q.Type) || !matchElement(elts[3], id) {
+				continue
+			}
+			for _, kind := range quotaMetricsKind {
+				if !matchElement(elts[4], kind) {
+					continue
+				}
+				metric := createMetric(core.NewNamespace(namespacePrefix...).
+					AddStaticElements(dfm.MountPoint, nsQuota, q.Type, id, kind), dfm, curTime)
+				metric.Tags_["quota_type"] = q.Type
+				metric.Tags_["quota_id"] = id
+				fillQuotaMetric(kind, q, curTime, &metric)
+				metrics = append(metrics, metric)
+			}
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,125 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/intelsdi-x/snap/core"
+)
+
+// mockQuotaReader returns quotas by device and type
+type mockQuotaReader struct {
+	quotas map[string]map[int][]quotaEntry
+	reads  int
+}
+
+func (m *mockQuotaReader) readQuotas(device string, quotaType int) ([]quotaEntry, error) {
+	m.reads++
+	entries, ok := m.quotas[device][quotaType]
+	if !ok {
+		return nil, errors.New("no such process")
+	}
+	return append([]quotaEntry{}, entries...), nil
+}
+
+func TestQuotas(t *testing.T) {
+	Convey("Given filesystems mounted with quota options", t, func() {
+		now := time.Now()
+		reader := &mockQuotaReader{quotas: map[string]map[int][]quotaEntry{
+			"/dev/sdb1": {
+				usrQuota: {
+					{ID: 1000, SpaceUsed: 1024, SpaceSoft: 4096, SpaceHard: 8192},
+					{ID: 1001, SpaceUsed: 6144, SpaceSoft: 4096, SpaceHard: 8192, SpaceGrace: now.Add(time.Hour)},
+					{ID: 1002, SpaceUsed: 2048, InodesUsed: 10, InodesGrace: now.Add(-time.Hour)},
+				},
+			},
+			"/dev/sdc1": {
+				prjQuota: {{ID: 7, SpaceUsed: 512, InodesUsed: 3, InodesSoft: 100, InodesHard: 200}},
+			},
+		}}
+		dfms := []dfMetric{
+			{Filesystem: "/dev/sdb1", MountPoint: "home", MountOptions: "rw,relatime", SuperOptions: "rw,usrquota,grpjquota=aquota.group"},
+			{Filesystem: "/dev/sdb1", MountPoint: "home_bind", MountOptions: "rw", SuperOptions: "rw,usrquota"},
+			{Filesystem: "/dev/sdc1", MountPoint: "projects", MountOptions: "rw", SuperOptions: "rw,attr2,inode64,prjquota"},
+			{Filesystem: "/dev/sdd1", MountPoint: "data", MountOptions: "rw", SuperOptions: "rw"},
+		}
+
+		Convey("When top quotas are filled", func() {
+			fillQuotas(reader, dfms, 2)
+
+			Convey("Then quotas using the most space are kept", func() {
+				So(len(dfms[0].Quotas), ShouldEqual, 2)
+				So(dfms[0].Quotas[0].ID, ShouldEqual, 1001)
+				So(dfms[0].Quotas[0].Type, ShouldEqual, "user")
+				So(dfms[0].Quotas[1].ID, ShouldEqual, 1002)
+				So(dfms[2].Quotas[0].Type, ShouldEqual, "project")
+				So(dfms[3].Quotas, ShouldBeEmpty)
+			})
+
+			Convey("Then quotas of the same device are read once per type", func() {
+				// user and group of /dev/sdb1, project of /dev/sdc1
+				So(reader.reads, ShouldEqual, 3)
+				So(dfms[1].Quotas, ShouldResemble, dfms[0].Quotas)
+			})
+
+			Convey("Then metrics are selected by namespace", func() {
+				metrics := quotaMetrics(core.NewNamespace("intel", "procfs", "filesystem", "home", "quota", "user", "*", "space_used"), dfms, now)
+				So(len(metrics), ShouldEqual, 2)
+				So(metrics[0].Namespace().String(), ShouldEqual, "/intel/procfs/filesystem/home/quota/user/1001/space_used")
+				So(metrics[0].Data(), ShouldEqual, 6144)
+				So(metrics[0].Tags()["quota_id"], ShouldEqual, "1001")
+				So(metrics[0].Tags()["quota_type"], ShouldEqual, "user")
+
+				metrics = quotaMetrics(core.NewNamespace("intel", "procfs", "filesystem", "*", "quota", "*", "1001", "space_grace_seconds"), dfms, now)
+				So(len(metrics), ShouldEqual, 2)
+				So(metrics[0].Data(), ShouldEqual, 3600.0)
+
+				metrics = quotaMetrics(core.NewNamespace("intel", "procfs", "filesystem", "home", "quota", "user", "1002", "inodes_grace_seconds"), dfms, now)
+				So(metrics[0].Data(), ShouldEqual, 0.0)
+
+				metrics = quotaMetrics(core.NewNamespace("intel", "procfs", "filesystem", "projects", "quota", "project", "7", "*"), dfms, now)
+				So(len(metrics), ShouldEqual, len(quotaMetricsKind))
+			})
+		})
+
+		Convey("When all quotas are filled", func() {
+			fillQuotas(reader, dfms, 0)
+			So(len(dfms[0].Quotas), ShouldEqual, 3)
+		})
+	})
+
+	Convey("Given mount options", t, func() {
+		So(quotaTypes("rw,relatime"), ShouldBeEmpty)
+		So(quotaTypes("rw,quota"), ShouldResemble, []int{usrQuota})
+		So(quotaTypes("rw", "rw,uquota,gqnoenforce,pquota"), ShouldResemble, []int{usrQuota, grpQuota, prjQuota})
+		So(quotaTypes("rw,grpjquota=aquota.group"), ShouldResemble, []int{grpQuota})
+	})
+
+	Convey("Given namespaces", t, func() {
+		So(isQuotaNamespace(core.NewNamespace("intel", "procfs", "filesystem", "home", "quota", "user", "1000", "space_used")), ShouldBeTrue)
+		So(isQuotaNamespace(core.NewNamespace("intel", "procfs", "filesystem", "directory", "quota", "largest", "x", "dir_bytes")), ShouldBeFalse)
+		So(isQuotaNamespace(core.NewNamespace("intel", "procfs", "filesystem", "home", "space_used")), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,107 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// refreshIntervals maps filesystem type or mount point pattern
+// (when starting with "/") to minimal interval between statfs calls
+type refreshIntervals map[string]time.Duration
+
+// parseRefreshIntervals parses list (see parseList) of <key>=<duration>
+// entries, eg. "nfs=5m,cifs=10m,/mnt/slow/*=1h"
+func parseRefreshIntervals(value string) (refreshIntervals, error) {
+	entries, err := parseList(RefreshIntervals, value)
+	if err != nil {
+		return nil, err
+	}
+	intervals := refreshIntervals{}
+	for _, entry := range entries {
+		idx := strings.LastIndex(entry, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("%s: wrong entry %q, expected <fs type or mount pattern>=<duration>", RefreshIntervals, entry)
+		}
+		key := strings.TrimSpace(entry[:idx])
+		interval, err := time.ParseDuration(strings.TrimSpace(entry[idx+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("%s: wrong duration for %q: %s", RefreshIntervals, key, err)
+		}
+		if strings.HasPrefix(key, "/") {
+			if _, err := path.Match(key, "/"); err != nil {
+				return nil, fmt.Errorf("%s: wrong mount point pattern %q: %s", RefreshIntervals, key, err)
+			}
+		}
+		intervals[key] = interval
+	}
+	return intervals, nil
+}
+
+// interval returns minimal interval between refreshes of given filesystem,
+// mount point patterns take precedence over filesystem types; of overlapping
+// patterns exact mount point wins, then the longest (most specific) pattern
+func (ri refreshIntervals) interval(mountPoint string, fsType string) time.Duration {
+	if interval, ok := ri[mountPoint]; ok && strings.HasPrefix(mountPoint, "/") {
+		return interval
+	}
+	best := ""
+	for key := range ri {
+		if !strings.HasPrefix(key, "/") {
+			continue
+		}
+		if matched, _ := path.Match(key, mountPoint); !matched {
+			continue
+		}
+		if best == "" || len(key) > len(best) || len(key) == len(best) && key < best {
+			best = key
+		}
+	}
+	if best != "" {
+		return ri[best]
+	}
+	return ri[fsType]
+}
+
+// fromCache fills usage of filesystem with previously collected values
+// if they are still valid, it returns false when statfs is needed
+func (dfs *dfStats) fromCache(dfm *dfMetric, intervals refreshIntervals, now time.Time) bool {
+	interval := intervals.interval(dfm.UnchangedMountPoint, dfm.FsType)
+	if interval <= 0 {
+		return false
+	}
+	prev, ok := dfs.cache[dfm.UnchangedMountPoint]
+	if !ok || prev.Filesystem != dfm.Filesystem || prev.FsType != dfm.FsType {
+		return false
+	}
+	if now.Sub(prev.Timestamp) >= interval {
+		return false
+	}
+	dfm.Blocks, dfm.Used, dfm.Available = prev.Blocks, prev.Used, prev.Available
+	dfm.Inodes, dfm.IUsed, dfm.IFree = prev.Inodes, prev.IUsed, prev.IFree
+	dfm.FSID = prev.FSID
+	dfm.Timestamp = prev.Timestamp
+	return true
+}
@@ -0,0 +1,107 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRefreshIntervals(t *testing.T) {
+	Convey("Given refresh intervals configuration", t, func() {
+
+		Convey("When configuration is valid", func() {
+			ri, err := parseRefreshIntervals("nfs=5m, cifs=10m,/mnt/slow/*=1h,")
+
+			Convey("Then intervals are parsed", func() {
+				So(err, ShouldBeNil)
+				So(len(ri), ShouldEqual, 3)
+				So(ri.interval("/home", "nfs"), ShouldEqual, 5*time.Minute)
+				So(ri.interval("/mnt/slow/a", "nfs"), ShouldEqual, time.Hour)
+				So(ri.interval("/", "ext4"), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When mount point patterns overlap", func() {
+			ri, err := parseRefreshIntervals("/mnt/*=1h,/mnt/fast=0s,/mnt/f*=5m,/mnt/?ast=10m")
+			So(err, ShouldBeNil)
+
+			Convey("Then exact mount point wins, then the most specific pattern", func() {
+				for i := 0; i < 20; i++ {
+					So(ri.interval("/mnt/fast", "ext4"), ShouldEqual, 0)
+					So(ri.interval("/mnt/last", "ext4"), ShouldEqual, 10*time.Minute)
+					So(ri.interval("/mnt/foo", "ext4"), ShouldEqual, 5*time.Minute)
+					So(ri.interval("/mnt/slow", "ext4"), ShouldEqual, time.Hour)
+				}
+			})
+		})
+
+		Convey("When configuration is invalid", func() {
+			_, err := parseRefreshIntervals("nfs")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, RefreshIntervals)
+
+			_, err = parseRefreshIntervals("nfs=often")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "wrong duration")
+
+			_, err = parseRefreshIntervals(`["nfs=5m"`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, RefreshIntervals+":")
+		})
+
+		Convey("When configuration is JSON array", func() {
+			ri, err := parseRefreshIntervals(`["nfs=5m", "/mnt/a,b=1h"]`)
+			So(err, ShouldBeNil)
+			So(ri, ShouldResemble, refreshIntervals{"nfs": 5 * time.Minute, "/mnt/a,b": time.Hour})
+		})
+	})
+
+	Convey("Given df stats with cache", t, func() {
+		dfs := &dfStats{cache: map[string]dfMetric{}}
+		metrics, err := dfs.collect("/proc", dfltExcludedFSNames, dfltExcludedFSTypes, true, refreshIntervals{}, nil)
+		So(err, ShouldBeNil)
+		So(metrics, ShouldNotBeEmpty)
+		first := metrics[0]
+
+		Convey("When filesystem type has refresh interval", func() {
+			ri := refreshIntervals{first.FsType: time.Hour}
+			metrics, err := dfs.collect("/proc", dfltExcludedFSNames, dfltExcludedFSTypes, true, ri, nil)
+
+			Convey("Then cached value with original timestamp is served", func() {
+				So(err, ShouldBeNil)
+				So(metrics[0].UnchangedMountPoint, ShouldEqual, first.UnchangedMountPoint)
+				So(metrics[0].Timestamp, ShouldEqual, first.Timestamp)
+			})
+		})
+
+		Convey("When filesystem type has no refresh interval", func() {
+			time.Sleep(time.Millisecond)
+			metrics, err := dfs.collect("/proc", dfltExcludedFSNames, dfltExcludedFSTypes, true, refreshIntervals{}, nil)
+
+			Convey("Then value is collected again", func() {
+				So(err, ShouldBeNil)
+				So(metrics[0].Timestamp, ShouldHappenAfter, first.Timestamp)
+			})
+		})
+	})
+}
@@ -0,0 +1,119 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"net"
+	"strings"
+)
+
+var (
+	// filesystem types which are served by a remote server
+	remoteFSTypes = []string{
+		"nfs",
+		"nfs4",
+		"cifs",
+		"smb3",
+		"smbfs",
+		"ceph",
+		"fuse.ceph",
+		"glusterfs",
+		"fuse.glusterfs",
+		"fuse.sshfs",
+		"lustre",
+		"afs",
+		"9p",
+		"beegfs",
+		"gpfs",
+		"davfs",
+		"fuse.s3fs",
+	}
+)
+
+// Return true if filesystem type is served by a remote server
+func isRemoteFSType(fsType string) bool {
+	return excludedFSFromList(fsType, remoteFSTypes)
+}
+
+// parseRemoteSource splits mount source of remote filesystem into
+// server part and exported path (eg. nfs01:/export/home, //fileserver/share
+// or 10.0.0.5:6789:/ for CephFS), ports and user names are dropped.
+// Empty strings are returned when source does not identify a server
+func parseRemoteSource(source string) (string, string) {
+	// CIFS/SMB: //server/share/path
+	if strings.HasPrefix(source, "//") {
+		rest := source[2:]
+		idx := strings.Index(rest, "/")
+		if idx < 0 {
+			return stripHost(rest), ""
+		}
+		return stripHost(rest[:idx]), rest[idx:]
+	}
+	var hosts, export string
+	if idx := strings.Index(source, ":/"); idx >= 0 {
+		hosts, export = source[:idx], source[idx+1:]
+	} else if idx := strings.LastIndex(source, ":"); idx >= 0 && strings.Count(source, ":") == 1 {
+		// volume names without leading slash (e.g. glusterfs server:volume)
+		hosts, export = source[:idx], source[idx+1:]
+	} else {
+		return "", ""
+	}
+	if hosts == "" {
+		return "", ""
+	}
+	// CephFS may list several monitors separated with comma
+	parts := strings.Split(hosts, ",")
+	servers := []string{}
+	for _, part := range parts {
+		if h := stripHost(part); h != "" {
+			servers = append(servers, h)
+		}
+	}
+	return strings.Join(servers, ","), export
+}
+
+// stripHost removes user and port parts from server address
+func stripHost(host string) string {
+	if idx := strings.LastIndex(host, "@"); idx >= 0 {
+		host = host[idx+1:]
+	}
+	if strings.HasPrefix(host, "[") {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			return h
+		}
+		return strings.Trim(host, "[]")
+	}
+	if strings.Count(host, ":") == 1 {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			return h
+		}
+	}
+	return host
+}
+
+// Function to fill remote filesystem attributes of metric
+func fillRemote(dfm *dfMetric) {
+	dfm.Remote = isRemoteFSType(dfm.FsType)
+	if dfm.Remote {
+		dfm.RemoteHost, dfm.RemoteExport = parseRemoteSource(dfm.Filesystem)
+	}
+}
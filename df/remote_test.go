@@ -0,0 +1,75 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRemote(t *testing.T) {
+	Convey("Given remote mount sources", t, func() {
+		sources := map[string][]string{
+			"nfs01:/export/home":            {"nfs01", "/export/home"},
+			"//fileserver/share":            {"fileserver", "/share"},
+			"//fileserver/share/sub":        {"fileserver", "/share/sub"},
+			"10.0.0.5:6789:/":               {"10.0.0.5", "/"},
+			"10.0.0.5:6789,10.0.0.6:6789:/": {"10.0.0.5,10.0.0.6", "/"},
+			"[fd00::1]:/export":             {"fd00::1", "/export"},
+			"user@backup:/srv":              {"backup", "/srv"},
+			"gluster01:volume":              {"gluster01", "volume"},
+			"/dev/sda1":                     {"", ""},
+		}
+		Convey("Then server and export are properly parsed", func() {
+			for source, expected := range sources {
+				host, export := parseRemoteSource(source)
+				So(host, ShouldEqual, expected[0])
+				So(export, ShouldEqual, expected[1])
+			}
+		})
+	})
+
+	Convey("Given filesystem metrics", t, func() {
+		nfs := dfMetric{Filesystem: "nfs01:/export/home", FsType: "nfs4"}
+		local := dfMetric{Filesystem: "/dev/sda1", FsType: "ext4"}
+		fillRemote(&nfs)
+		fillRemote(&local)
+
+		Convey("Then remote filesystems are classified by type", func() {
+			So(nfs.Remote, ShouldBeTrue)
+			So(nfs.RemoteHost, ShouldEqual, "nfs01")
+			So(nfs.RemoteExport, ShouldEqual, "/export/home")
+			So(local.Remote, ShouldBeFalse)
+			So(local.RemoteHost, ShouldBeEmpty)
+		})
+
+		Convey("Then tags describe remote server", func() {
+			tags := createTags(nfs)
+			So(tags["remote"], ShouldEqual, "true")
+			So(tags["remote_host"], ShouldEqual, "nfs01")
+			So(tags["remote_export"], ShouldEqual, "/export/home")
+
+			tags = createTags(local)
+			So(tags["remote"], ShouldEqual, "false")
+			So(tags, ShouldNotContainKey, "remote_host")
+		})
+	})
+}
@@ -0,0 +1,250 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package df
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"time"
+)
+
+// dirSize holds usage of directory tree
+type dirSize struct {
+	Bytes  uint64
+	Inodes uint64
+	// number of regular files
+	Files uint64
+	// false when walk stopped before visiting whole tree
+	Complete bool
+}
+
+// childSize holds usage of direct child of walked directory
+type childSize struct {
+	Name string
+	Size dirSize
+}
+
+// walkLimits bounds directory walk, zero values mean no limit
+type walkLimits struct {
+	MaxFiles int
+	MaxDepth int
+	Deadline time.Time
+	// paths which are not walked
+	Excluded []string
+}
+
+// fileID identifies inode to count hard links only once
+type fileID struct {
+	dev, ino uint64
+}
+
+// dirWalker walks directory tree within given limits,
+// it does not cross filesystem boundaries (like du -x)
+type dirWalker struct {
+	limits walkLimits
+	files  int
+	seen   map[fileID]bool
+	size   dirSize
+	// number of subtrees which were not fully walked
+	truncated int
+	// usage of direct children of walked directory
+	children []childSize
+	// cache of directory listings, nil if walk is not incremental
+	cache     *dirCache
+	cacheFull bool
+}
+
+// walkDirSize returns usage of directory tree within given limits
+func walkDirSize(root string, limits walkLimits) (dirSize, error) {
+	size, _, err := walkDir(root, limits)
+	return size, err
+}
+
+// walkDir returns usage of directory tree and of each of its direct children
+func walkDir(root string, limits walkLimits) (dirSize, []childSize, error) {
+	return walkDirCached(root, limits, nil)
+}
+
+// walkDirCached returns usage of directory tree reading again only
+// directories modified since they were cached, errDirCacheFull is returned
+// with incomplete usage if cache cannot hold all directories of the tree
+func walkDirCached(root string, limits walkLimits, cache *dirCache) (dirSize, []childSize, error) {
+	fi, err := os.Lstat(root)
+	if err != nil {
+		return dirSize{}, nil, err
+	}
+	w := &dirWalker{limits: limits, seen: map[fileID]bool{}, cache: cache}
+	w.size.Complete = true
+	w.add(fi)
+	if fi.IsDir() {
+		w.walk(root, fi, deviceOf(fi), 1)
+	}
+	if w.cacheFull {
+		return w.size, w.children, errDirCacheFull
+	}
+	return w.size, w.children, nil
+}
+
+// plus returns sum of usages
+func (s dirSize) plus(o dirSize) dirSize {
+	s.Bytes += o.Bytes
+	s.Inodes += o.Inodes
+	s.Files += o.Files
+	return s
+}
+
+// minus returns difference of usages
+func (s dirSize) minus(o dirSize) dirSize {
+	s.Bytes -= o.Bytes
+	s.Inodes -= o.Inodes
+	s.Files -= o.Files
+	return s
+}
+
+// Return device number of file
+func deviceOf(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev)
+	}
+	return 0
+}
+
+// add accounts file in directory tree usage
+func (w *dirWalker) add(fi os.FileInfo) {
+	w.files++
+	if fi.Mode().IsRegular() {
+		w.size.Files++
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		w.size.Inodes++
+		w.size.Bytes += uint64(fi.Size())
+		return
+	}
+	if st.Nlink > 1 && !fi.IsDir() {
+		id := fileID{uint64(st.Dev), uint64(st.Ino)}
+		if w.seen[id] {
+			return
+		}
+		w.seen[id] = true
+	}
+	w.size.Inodes++
+	// allocated size, sparse files are not overestimated
+	w.size.Bytes += uint64(st.Blocks) * 512
+}
+
+// Return true if walk reached its budget
+func (w *dirWalker) exhausted() bool {
+	if w.cacheFull || w.limits.MaxFiles > 0 && w.files >= w.limits.MaxFiles {
+		return true
+	}
+	return !w.limits.Deadline.IsZero() && time.Now().After(w.limits.Deadline)
+}
+
+// truncate marks walk as incomplete
+func (w *dirWalker) truncate() {
+	w.size.Complete = false
+	w.truncated++
+}
+
+// walkSubdir walks subdirectory unless depth limit is reached
+func (w *dirWalker) walkSubdir(dir string, fi os.FileInfo, dev uint64, depth int) {
+	if w.limits.MaxDepth > 0 && depth >= w.limits.MaxDepth {
+		w.truncate()
+		return
+	}
+	w.walk(dir, fi, dev, depth+1)
+}
+
+func (w *dirWalker) walk(dir string, dir_fi os.FileInfo, dev uint64, depth int) {
+	// listing of walked directory is always read to get usage of its children
+	if w.cache != nil && depth > 1 {
+		if entry := w.cache.lookup(dir_fi); entry != nil {
+			w.walkCached(dir, entry, dev, depth)
+			return
+		}
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		w.truncate()
+		return
+	}
+	start := w.size
+	subtrees := dirSize{}
+	subdirs := []string{}
+	for _, fi := range entries {
+		if w.exhausted() {
+			w.truncate()
+			return
+		}
+		file := path.Join(dir, fi.Name())
+		if deviceOf(fi) != dev || excludedFSFromList(file, w.limits.Excluded) {
+			continue
+		}
+		before, truncated := w.size, w.truncated
+		w.add(fi)
+		if fi.IsDir() {
+			// subdirectory is accounted by its parent also when listing is cached
+			subdirs = append(subdirs, fi.Name())
+			w.walkSubdir(file, fi, dev, depth)
+			subtrees = subtrees.plus(w.size.minus(before))
+		}
+		if depth == 1 {
+			w.children = append(w.children, childSize{
+				Name: fi.Name(),
+				Size: dirSize{
+					Bytes:    w.size.Bytes - before.Bytes,
+					Inodes:   w.size.Inodes - before.Inodes,
+					Files:    w.size.Files - before.Files,
+					Complete: w.truncated == truncated,
+				},
+			})
+		}
+	}
+	if w.cache != nil && depth > 1 {
+		if !w.cache.store(dir_fi, w.size.minus(start).minus(subtrees), subdirs) {
+			w.cacheFull = true
+			w.truncate()
+		}
+	}
+}
+
+// walkCached accounts cached listing of directory and walks its subdirectories
+func (w *dirWalker) walkCached(dir string, entry *dirEntry, dev uint64, depth int) {
+	w.size = w.size.plus(entry.own)
+	for _, name := range entry.subdirs {
+		if w.exhausted() {
+			w.truncate()
+			return
+		}
+		file := path.Join(dir, name)
+		fi, err := os.Lstat(file)
+		// removed subdirectory changes modification time of its parent
+		if err != nil || !fi.IsDir() || deviceOf(fi) != dev {
+			continue
+		}
+		w.add(fi)
+		w.walkSubdir(file, fi, dev, depth)
+	}
+}